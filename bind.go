@@ -0,0 +1,202 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrBindTarget is returned by the `Session.Bind` and `Session.Save` family of methods
+// when the target is not a struct or a pointer to a struct.
+var ErrBindTarget = errors.New("bind target should be a struct or a pointer to a struct")
+
+// bindField is a struct field that it's mapped onto a session key.
+type bindField struct {
+	index     []int
+	key       string
+	omitEmpty bool
+}
+
+var bindFieldsCache sync.Map // map[reflect.Type][]bindField
+
+// bindFields returns the fields of the struct type "typ" that are mapped onto session keys.
+//
+// The key is the field's "session" tag, i.e. `session:"user_id"`, or its name if not tagged.
+// The "omitempty" option removes the key on `Save` when the field has its zero value
+// and the "-" tag skips the field. Unexported fields are skipped and
+// the fields of an embedded struct without a tag are mapped as if they were in the outer struct.
+func bindFields(typ reflect.Type) []bindField {
+	if cached, ok := bindFieldsCache.Load(typ); ok {
+		return cached.([]bindField)
+	}
+
+	var fields []bindField
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag, tagged := field.Tag.Lookup("session")
+		if tag == "-" {
+			continue
+		}
+
+		if field.Anonymous && !tagged && field.Type.Kind() == reflect.Struct {
+			for _, embedded := range bindFields(field.Type) {
+				embedded.index = append([]int{i}, embedded.index...)
+				fields = append(fields, embedded)
+			}
+			continue
+		}
+
+		if field.PkgPath != "" { // unexported.
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		fields = append(fields, bindField{
+			index:     field.Index,
+			key:       name,
+			omitEmpty: opts == "omitempty",
+		})
+	}
+
+	bindFieldsCache.Store(typ, fields)
+	return fields
+}
+
+func structValue(v interface{}) (reflect.Value, bool) {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return reflect.Value{}, false
+		}
+		val = val.Elem()
+	}
+
+	return val, val.Kind() == reflect.Struct
+}
+
+// Bind fills the struct that "ptr" points to with the session's values,
+// each exported field is mapped onto a session key by its "session" tag,
+// i.e. `session:"user_id"`, or by its name. Fields that their key does not exist are left untouched.
+//
+// The values are converted to the field types across the representations that the databases return,
+// through the `DefaultTranscoder` if necessary, see `Get` too,
+// so a typed session model works the same on all databases.
+//
+// Use the `BindDocument` to read a struct stored as one value under a single key instead.
+func (s *Session) Bind(ptr interface{}) error {
+	return s.BindContext(context.Background(), ptr)
+}
+
+// BindContext same as `Bind` but it accepts a context,
+// which is passed to the registered database.
+func (s *Session) BindContext(ctx context.Context, ptr interface{}) error {
+	if reflect.ValueOf(ptr).Kind() != reflect.Ptr {
+		return ErrBindTarget
+	}
+
+	val, ok := structValue(ptr)
+	if !ok {
+		return ErrBindTarget
+	}
+
+	for _, field := range bindFields(val.Type()) {
+		value, err := s.GetE(ctx, field.key)
+		if err == ErrNotFound || (err == nil && value == nil) {
+			continue
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if !convertInto(val.FieldByIndex(field.index), value) {
+			return fmt.Errorf(errFindParse, val.FieldByIndex(field.index).Type(), field.key)
+		}
+	}
+
+	return nil
+}
+
+// Save stores the exported fields of the struct "v" as session values,
+// each field is mapped onto a session key by its "session" tag,
+// i.e. `session:"user_id"`, or by its name. A field with the "omitempty" option,
+// i.e. `session:"cart,omitempty"`, removes its key when it has its zero value.
+//
+// Use the `SaveDocument` to store a struct as one value under a single key instead.
+func (s *Session) Save(v interface{}) error {
+	return s.SaveContext(context.Background(), v)
+}
+
+// SaveContext same as `Save` but it accepts a context,
+// which is passed to the registered database.
+func (s *Session) SaveContext(ctx context.Context, v interface{}) error {
+	val, ok := structValue(v)
+	if !ok {
+		return ErrBindTarget
+	}
+
+	for _, field := range bindFields(val.Type()) {
+		fieldValue := val.FieldByIndex(field.index)
+		if field.omitEmpty && fieldValue.IsZero() {
+			if _, err := s.DeleteE(ctx, field.key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := s.set(ctx, field.key, fieldValue.Interface(), false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// BindDocument fills the "ptr" with the value stored under the "key" by the `SaveDocument`.
+// It returns the `ErrNotFound` if the "key" does not exist.
+func (s *Session) BindDocument(key string, ptr interface{}) error {
+	return s.BindDocumentContext(context.Background(), key, ptr)
+}
+
+// BindDocumentContext same as `BindDocument` but it accepts a context,
+// which is passed to the registered database.
+func (s *Session) BindDocumentContext(ctx context.Context, key string, ptr interface{}) error {
+	out := reflect.ValueOf(ptr)
+	if out.Kind() != reflect.Ptr || out.IsNil() {
+		return ErrBindTarget
+	}
+
+	value, err := s.GetE(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if value == nil {
+		return ErrNotFound
+	}
+
+	if !convertInto(out.Elem(), value) {
+		return fmt.Errorf(errFindParse, out.Elem().Type(), key)
+	}
+
+	return nil
+}
+
+// SaveDocument stores the "v" as one value under the "key",
+// use the `BindDocument` to read it back.
+func (s *Session) SaveDocument(key string, v interface{}) error {
+	return s.SaveDocumentContext(context.Background(), key, v)
+}
+
+// SaveDocumentContext same as `SaveDocument` but it accepts a context,
+// which is passed to the registered database.
+func (s *Session) SaveDocumentContext(ctx context.Context, key string, v interface{}) error {
+	return s.set(ctx, key, v, false)
+}
@@ -1,6 +1,7 @@
 package sessions
 
 import (
+	"net/http"
 	"time"
 
 	"github.com/google/uuid"
@@ -56,6 +57,42 @@ type (
 		// Defaults to false.
 		CookieSecureTLS bool
 
+		// CookiePath is the session's cookie "Path" attribute,
+		// useful to scope the sessions to an app's path.
+		//
+		// Defaults to "/".
+		CookiePath string
+
+		// CookieDomain is the session's cookie "Domain" attribute.
+		// When empty the domain is resolved by the request's host,
+		// see `DisableSubdomainPersistence` too.
+		//
+		// Defaults to empty.
+		CookieDomain string
+
+		// CookieSameSite is the session's cookie "SameSite" attribute,
+		// e.g. http.SameSiteLaxMode.
+		// Note that browsers accept the http.SameSiteNoneMode only on secure cookies.
+		//
+		// Defaults to zero, no "SameSite" attribute is sent.
+		CookieSameSite http.SameSite
+
+		// CookiePartitioned set to true in order to send the "Partitioned" attribute (CHIPS),
+		// a partitioned cookie is always secure.
+		//
+		// Defaults to false.
+		CookiePartitioned bool
+
+		// CookieOptions can modify the session's cookie right before sent to the client,
+		// for both net/http and valyala/fasthttp sessions, including the cookie removal.
+		//
+		// Note that the cookie name prefixes are respected after this call:
+		// a "__Secure-" cookie is always secure and
+		// a "__Host-" cookie is always secure, with "/" path and without domain.
+		//
+		// Defaults to nil.
+		CookieOptions func(*http.Cookie)
+
 		// AllowReclaim will allow to
 		// Destroy and Start a session in the same request handler.
 		// All it does is that it removes the cookie for both `Request` and `ResponseWriter` while `Destroy`
@@ -103,6 +140,114 @@ type (
 		// Defaults to infinitive/unlimited life duration(0).
 		Expires time.Duration
 
+		// Strict set to true in order to accept only session ids that are known by the server,
+		// an unknown or forged session id is discarded and a fresh, server-generated, one is issued instead.
+		// The registered database is asked whether the session id exists before creating it,
+		// see the `Exister` interface.
+		//
+		// Defaults to false.
+		Strict bool
+
+		// VerifyExists set to true in order to ask the registered database, on each request,
+		// whether a session which is kept in memory still exists, see the `Exister` interface,
+		// so a session destroyed by another instance of the application, i.e. through the `DestroyOwner`,
+		// is not served by this one. It costs a database round trip per request.
+		//
+		// Defaults to false.
+		VerifyExists bool
+
+		// Lazy set to true in order to store the session and send its id to the client
+		// only on its first write, e.g. `Set` or `SetFlash`,
+		// so requests that never write to the session do not create a session or a cookie.
+		// Under the `Handler` middleware the session id is sent right before the response is written,
+		// otherwise it is sent on the first write, so it must happen before the response is written.
+		//
+		// Defaults to false.
+		Lazy bool
+
+		// WriteBehind set to true in order to buffer the changes of a session
+		// and write them to the registered database in one batch per request,
+		// instead of one database call per `Set`, `Delete` or `Clear`.
+		// The session's values are loaded once per request and the reads are served from memory.
+		// The `Handler` and `HandlerFasthttp` middlewares write the changes when the handler has finished
+		// and the `Handler` right before the response is written too, otherwise call the `Session.Commit`.
+		// It does not affect the client-side sessions, see `UseCookieStore`.
+		//
+		// Defaults to false.
+		WriteBehind bool
+
+		// LockLease is the maximum duration that the lock of a session, see `Session.Lock`, is held,
+		// so a lock is not held forever by a terminated process or a stuck request.
+		//
+		// Defaults to 30 seconds.
+		LockLease time.Duration
+
+		// MaxSessionsPerOwner is the maximum number of the concurrent sessions of an owner,
+		// i.e. the devices that a user is logged in, see `Session.SetOwner`.
+		// When the limit is reached, a new session of the owner is handled by the `OwnerLimitPolicy`.
+		// The limit is enforced under the owner's lock, across the instances of the application
+		// if the registered database implements the `Locker` interface, see `Session.Lock`.
+		// It does not limit the client-side sessions, see `UseCookieStore`.
+		//
+		// Defaults to zero, unlimited.
+		MaxSessionsPerOwner int
+
+		// OwnerLimitPolicy decides how a new session of an owner is handled
+		// when the owner has reached the `MaxSessionsPerOwner` limit,
+		// see `OwnerLimitReject`, `OwnerLimitEvictOldest` and `OwnerLimitEvictLRU`.
+		//
+		// Defaults to OwnerLimitReject.
+		OwnerLimitPolicy OwnerLimitPolicy
+
+		// Fingerprint binds a session to the fingerprint of the client which created it,
+		// i.e. the `UserAgentFingerprint`, the `IPFingerprint`, the `TLSFingerprint`
+		// or a combination of them through the `Fingerprints`,
+		// so a stolen session id can not be used by another client.
+		// The fingerprint is compared on every `Start` and `StartFasthttp`,
+		// a mismatch is handled by the `FingerprintPolicy`, see `OnFingerprintMismatch` too.
+		//
+		// Defaults to nil, sessions are not bound to a fingerprint.
+		Fingerprint Fingerprinter
+
+		// FingerprintPolicy decides how a request with a different fingerprint than
+		// the one that its session is bound to is handled,
+		// see `FingerprintReject`, `FingerprintDestroy` and `FingerprintReport`.
+		//
+		// Defaults to FingerprintReject.
+		FingerprintPolicy FingerprintPolicy
+
+		// SlidingExpiration set to true in order to move the session's expiration forward,
+		// by the `Expires` (or `IdleTimeout` if set), on `Start`,
+		// so the `ShiftExpiration` calls are not required.
+		// The database is updated and the client's cookie is sent again only when the remaining lifetime
+		// drops below the `SlidingRefreshFraction` of it.
+		//
+		// Defaults to false.
+		SlidingExpiration bool
+
+		// SlidingRefreshFraction is the fraction, between 0 and 1, of the session's lifetime
+		// that the remaining lifetime should drop below in order to move the expiration forward,
+		// when `SlidingExpiration` is true. A value of 1 moves it on every request.
+		//
+		// Defaults to 0.5.
+		SlidingRefreshFraction float64
+
+		// IdleTimeout expires the session after this duration without a request,
+		// each request of the client moves the session's expiration forward.
+		// When set, it replaces the `Expires` as the server-side lifetime of the session,
+		// the `Expires` is still used for the client's cookie.
+		//
+		// Defaults to zero, no idle timeout.
+		IdleTimeout time.Duration
+
+		// AbsoluteTimeout is the hard limit of a session's lifetime since its creation,
+		// no idle shift or `UpdateExpiration` call can extend it.
+		// The creation time is stored to the registered database,
+		// so the limit is respected across application restarts.
+		//
+		// Defaults to zero, no absolute timeout.
+		AbsoluteTimeout time.Duration
+
 		// SessionIDGenerator should returns a random session id.
 		// By default we will use a uuid impl package to generate
 		// that, but developers can change that with simple assignment.
@@ -112,6 +257,13 @@ type (
 		//
 		// Defaults to false.
 		DisableSubdomainPersistence bool
+
+		// Transport sends and receives the session id to and from the client.
+		// Builtin transports are the `CookieTransport`, the `HeaderTransport` (see `NewBearerTransport` too)
+		// and the `QueryTransport`.
+		//
+		// Defaults to a `CookieTransport` based on the cookie fields of this configuration.
+		Transport Transport
 	}
 )
 
@@ -122,6 +274,18 @@ func (c Config) Validate() Config {
 		c.Cookie = DefaultCookieName
 	}
 
+	if c.CookiePath == "" {
+		c.CookiePath = "/"
+	}
+
+	if c.SlidingRefreshFraction <= 0 || c.SlidingRefreshFraction > 1 {
+		c.SlidingRefreshFraction = 0.5
+	}
+
+	if c.LockLease <= 0 {
+		c.LockLease = 30 * time.Second
+	}
+
 	if c.SessionIDGenerator == nil {
 		c.SessionIDGenerator = func() string {
 			id, _ := uuid.NewRandom()
@@ -134,5 +298,9 @@ func (c Config) Validate() Config {
 		c.Decode = c.Encoding.Decode
 	}
 
+	if c.Transport == nil {
+		c.Transport = NewCookieTransport(c)
+	}
+
 	return c
 }
@@ -46,6 +46,30 @@ func AddCookie(w http.ResponseWriter, r *http.Request, cookie *http.Cookie, recl
 	http.SetCookie(w, cookie)
 }
 
+// SetRequestCookie sets or replaces the request's cookie value by it's name.
+// Useful when the request's cookies should reflect a change
+// made on the response's cookies of the same request.
+func SetRequestCookie(r *http.Request, name string, value string) {
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+
+	found := false
+	for _, c := range cookies {
+		if c.Name == name {
+			if found { // duplicated, i.e from a previous `AddCookie` with reclaim.
+				continue
+			}
+			c.Value = value
+			found = true
+		}
+		r.AddCookie(c)
+	}
+
+	if !found {
+		r.AddCookie(&http.Cookie{Name: name, Value: value})
+	}
+}
+
 // AddCookieFasthttp adds a cookie.
 func AddCookieFasthttp(ctx *fasthttp.RequestCtx, cookie *fasthttp.Cookie) {
 	ctx.Response.Header.SetCookie(cookie)
@@ -53,18 +77,15 @@ func AddCookieFasthttp(ctx *fasthttp.RequestCtx, cookie *fasthttp.Cookie) {
 
 // RemoveCookie deletes a cookie by it's name/key.
 func RemoveCookie(w http.ResponseWriter, r *http.Request, config Config) {
-	c, err := r.Cookie(config.Cookie)
-	if err != nil {
+	if _, err := r.Cookie(config.Cookie); err != nil {
 		return
 	}
 
+	c := newCookie(config, r.URL.Host, r.TLS != nil, "")
 	c.Expires = CookieExpireDelete
 	// MaxAge<0 means delete cookie now, equivalently 'Max-Age: 0'
 	c.MaxAge = -1
-	c.Value = ""
-	c.Path = "/"
-	c.Domain = formatCookieDomain(r.URL.Host, config.DisableSubdomainPersistence)
-	AddCookie(w, r, c, config.AllowReclaim)
+	writeCookie(w, c, config.CookiePartitioned)
 
 	if config.AllowReclaim {
 		// delete request's cookie also, which is temporary available.
@@ -74,23 +95,106 @@ func RemoveCookie(w http.ResponseWriter, r *http.Request, config Config) {
 
 // RemoveCookieFasthttp deletes a cookie by it's name/key.
 func RemoveCookieFasthttp(ctx *fasthttp.RequestCtx, config Config) {
-	ctx.Response.Header.DelCookie(config.Cookie)
-
-	cookie := fasthttp.AcquireCookie()
-	//cookie := &fasthttp.Cookie{}
-	cookie.SetKey(config.Cookie)
-	cookie.SetValue("")
-	cookie.SetPath("/")
-	cookie.SetDomain(formatCookieDomain(string(ctx.Host()), config.DisableSubdomainPersistence))
-	cookie.SetHTTPOnly(true)
-	exp := time.Now().Add(-time.Duration(1) * time.Minute) //RFC says 1 second, but let's do it 1 minute to make sure is working...
-	cookie.SetExpire(exp)
-	AddCookieFasthttp(ctx, cookie)
-	fasthttp.ReleaseCookie(cookie)
+	c := newCookie(config, string(ctx.Host()), ctx.IsTLS(), "")
+	c.Expires = time.Now().Add(-time.Duration(1) * time.Minute) //RFC says 1 second, but let's do it 1 minute to make sure is working...
+	c.MaxAge = -1
+	writeCookieFasthttp(ctx, c, config.CookiePartitioned)
 	// delete request's cookie also, which is temporary available
 	ctx.Request.Header.DelCookie(config.Cookie)
 }
 
+const (
+	// cookieHostPrefix is the cookie name prefix which makes browsers to accept the cookie
+	// only if it's secure, it's path is "/" and it has no domain.
+	cookieHostPrefix = "__Host-"
+	// cookieSecurePrefix is the cookie name prefix which makes browsers to accept the cookie
+	// only if it's secure.
+	cookieSecurePrefix = "__Secure-"
+)
+
+// newCookie returns a new session cookie, without expiration,
+// which respects the cookie fields of the "config".
+// The "host" is the request's host, used to resolve the domain when `Config.CookieDomain` is missing.
+func newCookie(config Config, host string, tls bool, value string) *http.Cookie {
+	c := &http.Cookie{
+		Name:     config.Cookie,
+		Value:    value,
+		Path:     config.CookiePath,
+		Domain:   config.CookieDomain,
+		HttpOnly: true,
+		SameSite: config.CookieSameSite,
+		// set the cookie to secure if this is a tls wrapped request
+		// and the configuration allows it.
+		Secure: tls && config.CookieSecureTLS,
+	}
+
+	if c.Path == "" {
+		c.Path = "/"
+	}
+
+	if c.Domain == "" {
+		c.Domain = formatCookieDomain(host, config.DisableSubdomainPersistence)
+	}
+
+	if config.CookieOptions != nil {
+		config.CookieOptions(c)
+	}
+
+	// browsers reject cookies that do not follow their rules, so force them.
+	if config.CookiePartitioned {
+		c.Secure = true
+	}
+
+	if strings.HasPrefix(c.Name, cookieHostPrefix) {
+		c.Secure = true
+		c.Path = "/"
+		c.Domain = ""
+	} else if strings.HasPrefix(c.Name, cookieSecurePrefix) {
+		c.Secure = true
+	}
+
+	return c
+}
+
+// formatCookie returns the "Set-Cookie" header value of the "c" cookie.
+func formatCookie(c *http.Cookie, partitioned bool) string {
+	v := c.String()
+	if v != "" && partitioned && !strings.Contains(v, "; Partitioned") {
+		// CHIPS, the net/http.Cookie serializes it by itself
+		// only if its Partitioned field (Go 1.23+) is set.
+		v += "; Partitioned"
+	}
+
+	return v
+}
+
+// writeCookie sends the "c" cookie to the client, it replaces any previous one with the same name.
+func writeCookie(w http.ResponseWriter, c *http.Cookie, partitioned bool) {
+	v := formatCookie(c, partitioned)
+	if v == "" {
+		return
+	}
+
+	header := w.Header()
+	prefix := c.Name + "="
+	setCookies := header["Set-Cookie"][:0]
+	for _, setCookie := range header["Set-Cookie"] {
+		if !strings.HasPrefix(setCookie, prefix) {
+			setCookies = append(setCookies, setCookie)
+		}
+	}
+
+	header["Set-Cookie"] = append(setCookies, v)
+}
+
+// writeCookieFasthttp sends the "c" cookie to the client, it replaces any previous one with the same name.
+func writeCookieFasthttp(ctx *fasthttp.RequestCtx, c *http.Cookie, partitioned bool) {
+	if v := formatCookie(c, partitioned); v != "" {
+		ctx.Response.Header.DelCookie(c.Name)
+		ctx.Response.Header.Set("Set-Cookie", v)
+	}
+}
+
 // IsValidCookieDomain returns true if the receiver is a valid domain to set
 // valid means that is recognised as 'domain' by the browser, so it(the cookie) can be shared with subdomains also
 func IsValidCookieDomain(domain string) bool {
@@ -0,0 +1,576 @@
+package sessions
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// DefaultCookieMaxSize is the default maximum size of an encoded client-side session.
+// Browsers limit a cookie, including its name and attributes, to 4096 bytes.
+const DefaultCookieMaxSize = 3800
+
+// ErrCookieTooLarge is returned when an encoded client-side session
+// does not fit to the `CookieStore.MaxSize`.
+var ErrCookieTooLarge = errors.New("session cookie too large")
+
+// errInvalidCookie is returned when a client-side session can not be decoded.
+var errInvalidCookie = errors.New("invalid session cookie")
+
+// CookieStore keeps the whole session (values, flash messages and lifetime)
+// inside an authenticated and encrypted (AES-GCM) client cookie, there is no server storage.
+// Useful for stateless services, note that a cookie session is limited by the cookie size
+// and it can not be destroyed from the server-side unless its id is revoked through a `Denylist`.
+//
+// Register it through the `Sessions.UseCookieStore`.
+// The session is sent to the client by the `Handler` and `HandlerFasthttp` middlewares
+// right before the response is written, or manually by the `Commit` and `CommitFasthttp` methods.
+//
+// Values of custom types should be registered through `gob.Register`, unless a `Transcoder` is used.
+type CookieStore struct {
+	aead cipher.AEAD
+
+	// Transcoder encodes and decodes the session before encryption.
+	//
+	// Defaults to nil, the session is encoded with gob, as the `Store.Serialize` does.
+	Transcoder Transcoder
+	// MaxSize is the maximum size of an encoded session,
+	// a session which exceeds that is not sent to the client and the `ErrCookieTooLarge` is reported.
+	//
+	// Defaults to `DefaultCookieMaxSize`.
+	MaxSize int
+	// Denylist keeps the revoked session ids, i.e. after `Destroy` or `Regenerate`,
+	// so a copy of a client's cookie is not accepted after logout.
+	//
+	// Defaults to an in-memory denylist, use the `NewDatabaseDenylist`
+	// to share the revoked session ids between instances.
+	Denylist Denylist
+	// ErrorHandler is fired when a session could not be sent
+	// to the client by the `Handler` and `HandlerFasthttp` middlewares,
+	// i.e. on `ErrCookieTooLarge`.
+	//
+	// Defaults to nil.
+	ErrorHandler func(sid string, err error)
+}
+
+// NewCookieStore returns a new client-side sessions store.
+// The "secret" is the AES key, it should be 16, 24 or 32 bytes long,
+// otherwise an error is returned.
+func NewCookieStore(secret []byte) (*CookieStore, error) {
+	block, err := aes.NewCipher(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CookieStore{
+		aead:     aead,
+		MaxSize:  DefaultCookieMaxSize,
+		Denylist: NewMemoryDenylist(),
+	}, nil
+}
+
+// cookiePayload is the encoded form of a client-side session.
+type cookiePayload struct {
+	ID      string
+	Values  Store
+	Flashes map[string]interface{}
+	Expires time.Time
+}
+
+// encode encrypts the "payload", the "name" is the cookie name which the payload is bound to.
+func (c *CookieStore) encode(name string, payload cookiePayload) (string, error) {
+	var (
+		b   []byte
+		err error
+	)
+
+	if c.Transcoder != nil {
+		b, err = c.Transcoder.Marshal(payload)
+	} else {
+		w := new(bytes.Buffer)
+		err = gob.NewEncoder(w).Encode(payload)
+		b = w.Bytes()
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	value := base64.RawURLEncoding.EncodeToString(c.aead.Seal(nonce, nonce, b, []byte(name)))
+	if maxSize := c.MaxSize; maxSize > 0 && len(value) > maxSize {
+		return "", ErrCookieTooLarge
+	}
+
+	return value, nil
+}
+
+// decode decrypts the client's cookie "value".
+func (c *CookieStore) decode(name string, value string) (payload cookiePayload, err error) {
+	if value == "" {
+		return payload, errInvalidCookie
+	}
+
+	if maxSize := c.MaxSize; maxSize > 0 && len(value) > maxSize {
+		return payload, ErrCookieTooLarge
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return
+	}
+
+	nonceSize := c.aead.NonceSize()
+	if len(b) < nonceSize {
+		return payload, errInvalidCookie
+	}
+
+	b, err = c.aead.Open(nil, b[:nonceSize], b[nonceSize:], []byte(name))
+	if err != nil {
+		return
+	}
+
+	if c.Transcoder != nil {
+		err = c.Transcoder.Unmarshal(b, &payload)
+	} else {
+		err = gob.NewDecoder(bytes.NewReader(b)).Decode(&payload)
+	}
+
+	if err == nil && payload.ID == "" {
+		err = errInvalidCookie
+	}
+
+	return
+}
+
+// revoke adds the "sid" to the denylist until "until", a zero "until" means forever.
+func (c *CookieStore) revoke(ctx context.Context, sid string, until time.Time) error {
+	if c.Denylist == nil {
+		return nil
+	}
+
+	if until.IsZero() {
+		until = CookieExpireUnlimited
+	}
+
+	return c.Denylist.Revoke(ctx, sid, until)
+}
+
+func (c *CookieStore) isRevoked(ctx context.Context, sid string) bool {
+	if c.Denylist == nil {
+		return false
+	}
+
+	revoked, err := c.Denylist.IsRevoked(ctx, sid)
+	return revoked || err != nil
+}
+
+// Denylist keeps the revoked session ids of the client-side sessions, see `CookieStore`.
+type Denylist interface {
+	// Revoke rejects the "sid" until the "until" time,
+	// the time that the session would expire anyway.
+	Revoke(ctx context.Context, sid string, until time.Time) error
+	// IsRevoked reports whether the "sid" is rejected.
+	IsRevoked(ctx context.Context, sid string) (bool, error)
+}
+
+type memoryDenylist struct {
+	mu      sync.Mutex
+	revoked map[string]time.Time
+}
+
+// NewMemoryDenylist returns a new in-memory `Denylist`,
+// the revoked session ids are not shared between instances and they are lost on restart.
+func NewMemoryDenylist() Denylist {
+	return &memoryDenylist{revoked: make(map[string]time.Time)}
+}
+
+func (d *memoryDenylist) Revoke(_ context.Context, sid string, until time.Time) error {
+	now := time.Now()
+
+	d.mu.Lock()
+	for revokedSid, revokedUntil := range d.revoked { // remove the expired ones.
+		if revokedUntil.Before(now) {
+			delete(d.revoked, revokedSid)
+		}
+	}
+	d.revoked[sid] = until
+	d.mu.Unlock()
+	return nil
+}
+
+func (d *memoryDenylist) IsRevoked(_ context.Context, sid string) (bool, error) {
+	d.mu.Lock()
+	until, found := d.revoked[sid]
+	d.mu.Unlock()
+	return found && until.After(time.Now()), nil
+}
+
+// denylistKey is the reserved key of a revoked session id's entry.
+const denylistKey = reservedKeyPrefix + "revoked"
+
+type databaseDenylist struct {
+	db DatabaseContext
+}
+
+// NewDatabaseDenylist returns a new `Denylist` which stores the revoked session ids
+// to a session database, i.e. a redis one, so they are shared between instances.
+// Each revoked session id is stored as a database session that expires when the revocation does.
+func NewDatabaseDenylist(db DatabaseContext) Denylist {
+	return &databaseDenylist{db: db}
+}
+
+func (d *databaseDenylist) Revoke(ctx context.Context, sid string, until time.Time) error {
+	expires := time.Until(until)
+	if expires <= 0 {
+		return nil
+	}
+
+	revokedSid := denylistKey + "_" + sid
+	lifetime, err := d.db.AcquireContext(ctx, revokedSid, expires)
+	if err != nil {
+		return err
+	}
+
+	if lifetime.IsZero() {
+		lifetime.Time = until
+	}
+
+	return d.db.SetContext(ctx, revokedSid, lifetime, denylistKey, true, false)
+}
+
+func (d *databaseDenylist) IsRevoked(ctx context.Context, sid string) (bool, error) {
+	_, err := d.db.GetContext(ctx, denylistKey+"_"+sid, denylistKey)
+	if err == ErrNotFound {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// cookieDatabase is the `DatabaseContext` of a single client-side session,
+// it keeps the values until the session is sent to the client.
+type cookieDatabase struct {
+	store    *CookieStore
+	mu       sync.RWMutex
+	values   Store
+	lifetime *LifeTime
+	released bool
+}
+
+var _ DatabaseContext = (*cookieDatabase)(nil)
+
+func (db *cookieDatabase) AcquireContext(context.Context, string, time.Duration) (LifeTime, error) {
+	return LifeTime{}, nil
+}
+
+// Do nothing, the `LifeTime` of the Session is sent to the client with the rest of the session.
+func (db *cookieDatabase) OnUpdateExpirationContext(context.Context, string, time.Duration) error {
+	return nil
+}
+
+func (db *cookieDatabase) SetContext(_ context.Context, _ string, _ LifeTime, key string, value interface{}, immutable bool) error {
+	db.mu.Lock()
+	db.values.Save(key, value, immutable)
+	db.mu.Unlock()
+	return nil
+}
+
+func (db *cookieDatabase) GetContext(_ context.Context, _ string, key string) (interface{}, error) {
+	db.mu.RLock()
+	v := db.values.Get(key)
+	db.mu.RUnlock()
+	if v == nil {
+		return nil, ErrNotFound
+	}
+
+	return v, nil
+}
+
+func (db *cookieDatabase) VisitContext(_ context.Context, _ string, cb func(key string, value interface{})) error {
+	db.mu.RLock()
+	values := append(Store(nil), db.values...)
+	db.mu.RUnlock()
+
+	values.Visit(cb)
+	return nil
+}
+
+func (db *cookieDatabase) LenContext(context.Context, string) (int, error) {
+	db.mu.RLock()
+	n := db.values.Len()
+	db.mu.RUnlock()
+	return n, nil
+}
+
+func (db *cookieDatabase) DeleteContext(_ context.Context, _ string, key string) (bool, error) {
+	db.mu.Lock()
+	removed := db.values.Remove(key)
+	db.mu.Unlock()
+	return removed, nil
+}
+
+func (db *cookieDatabase) ClearContext(context.Context, string) error {
+	db.mu.Lock()
+	db.values.Reset()
+	db.mu.Unlock()
+	return nil
+}
+
+// ReleaseContext revokes the session id, the client's cookie
+// should be removed by the caller.
+func (db *cookieDatabase) ReleaseContext(ctx context.Context, sid string) error {
+	db.mu.Lock()
+	db.values.Reset()
+	db.released = true
+	db.mu.Unlock()
+
+	return db.store.revoke(ctx, sid, db.lifetime.Time)
+}
+
+func (db *cookieDatabase) isReleased() bool {
+	db.mu.RLock()
+	released := db.released
+	db.mu.RUnlock()
+	return released
+}
+
+// UseCookieStore makes the manager to keep the sessions to the client, see `CookieStore`.
+// The registered databases are not used by the client-side sessions.
+func UseCookieStore(store *CookieStore) {
+	Default.UseCookieStore(store)
+}
+
+// UseCookieStore makes the manager to keep the sessions to the client, see `CookieStore`.
+// The registered databases are not used by the client-side sessions.
+func (s *Sessions) UseCookieStore(store *CookieStore) {
+	s.cookies = store
+}
+
+// Commit sends the client-side session "sess" to the client, see `UseCookieStore`.
+// The `Handler` middleware calls it right before the response is written,
+// call it manually when the `Handler` is not used.
+//
+// It returns `ErrCookieTooLarge` if the session does not fit to a cookie.
+// It does nothing on server-side sessions.
+func Commit(w http.ResponseWriter, r *http.Request, sess *Session) error {
+	return Default.Commit(w, r, sess)
+}
+
+// Commit sends the client-side session "sess" to the client, see `UseCookieStore`.
+// The `Handler` middleware calls it right before the response is written,
+// call it manually when the `Handler` is not used.
+//
+// It returns `ErrCookieTooLarge` if the session does not fit to a cookie.
+// It does nothing on server-side sessions.
+func (s *Sessions) Commit(w http.ResponseWriter, r *http.Request, sess *Session) error {
+	value, expires, err := s.encodeCookieSession(sess)
+	if err != nil || value == "" {
+		return err
+	}
+
+	s.config.Transport.Set(w, r, value, expires)
+	return nil
+}
+
+// CommitFasthttp sends the client-side session "sess" to the client, see `UseCookieStore`.
+// The `HandlerFasthttp` middleware calls it after its next handler,
+// call it manually when the `HandlerFasthttp` is not used.
+//
+// It returns `ErrCookieTooLarge` if the session does not fit to a cookie.
+// It does nothing on server-side sessions.
+func CommitFasthttp(ctx *fasthttp.RequestCtx, sess *Session) error {
+	return Default.CommitFasthttp(ctx, sess)
+}
+
+// CommitFasthttp sends the client-side session "sess" to the client, see `UseCookieStore`.
+// The `HandlerFasthttp` middleware calls it after its next handler,
+// call it manually when the `HandlerFasthttp` is not used.
+//
+// It returns `ErrCookieTooLarge` if the session does not fit to a cookie.
+// It does nothing on server-side sessions.
+func (s *Sessions) CommitFasthttp(ctx *fasthttp.RequestCtx, sess *Session) error {
+	value, expires, err := s.encodeCookieSession(sess)
+	if err != nil || value == "" {
+		return err
+	}
+
+	s.config.Transport.SetFasthttp(ctx, value, expires)
+	return nil
+}
+
+func (s *Sessions) commitOnResponse(w http.ResponseWriter, r *http.Request, sess *Session) {
+	if err := s.Commit(w, r, sess); err != nil && s.cookies.ErrorHandler != nil {
+		s.cookies.ErrorHandler(sess.ID(), err)
+	}
+}
+
+func (s *Sessions) commitOnResponseFasthttp(ctx *fasthttp.RequestCtx, sess *Session) {
+	if err := s.CommitFasthttp(ctx, sess); err != nil && s.cookies.ErrorHandler != nil {
+		s.cookies.ErrorHandler(sess.ID(), err)
+	}
+}
+
+// encodeCookieSession returns the encoded client-side session and its cookie's expiration,
+// it returns an empty value if the "sess" is not a client-side one or it's destroyed.
+func (s *Sessions) encodeCookieSession(sess *Session) (string, time.Duration, error) {
+	db, ok := sess.db.(*cookieDatabase)
+	if !ok || db.isReleased() || sess.isPending() {
+		return "", 0, nil
+	}
+
+	payload := cookiePayload{
+		ID:      sess.ID(),
+		Flashes: make(map[string]interface{}),
+		Expires: sess.Lifetime.Time,
+	}
+
+	db.mu.RLock()
+	payload.Values = append(Store(nil), db.values...)
+	db.mu.RUnlock()
+
+	sess.mu.RLock()
+	for key, v := range sess.flashes {
+		if !v.shouldRemove { // removed on the next request anyway.
+			payload.Flashes[key] = v.value
+		}
+	}
+	sess.mu.RUnlock()
+
+	value, err := s.cookies.encode(s.config.Cookie, payload)
+	if err != nil {
+		return "", 0, err
+	}
+
+	expires := s.config.Expires
+	if expires >= 0 && !sess.Lifetime.IsZero() {
+		expires = sess.Lifetime.DurationUntilExpiration()
+	}
+
+	return value, expires, nil
+}
+
+// cookieSession returns the client-side session of the request's "ctx" or
+// the one decoded by the client's "value".
+// A new session is returned if it's missing, invalid, expired or revoked.
+func (s *Sessions) cookieSession(ctx context.Context, value string) *Session {
+	if sess := s.fromContext(ctx); sess != nil {
+		return sess
+	}
+
+	payload, err := s.cookies.decode(s.config.Cookie, value)
+	isNew := err != nil || s.cookies.isRevoked(ctx, payload.ID) ||
+		(!payload.Expires.IsZero() && payload.Expires.Before(time.Now()))
+
+	var created time.Time
+	if !isNew && s.config.AbsoluteTimeout > 0 {
+		var ok bool
+		created, ok = parseCreated(payload.Values.Get(createdKey))
+		isNew = !ok || time.Since(created) >= s.config.AbsoluteTimeout
+	}
+
+	if isNew {
+		payload = cookiePayload{ID: s.config.SessionIDGenerator()}
+		created = time.Now()
+	}
+
+	db := &cookieDatabase{store: s.cookies, values: payload.Values}
+	sess := &Session{
+		isNew:    isNew,
+		flashes:  make(map[string]*flashMessage, len(payload.Flashes)),
+		Lifetime: LifeTime{Time: payload.Expires},
+		provider: s.provider,
+		db:       db,
+	}
+	sess.setID(payload.ID)
+	db.lifetime = &sess.Lifetime
+
+	for key, value := range payload.Flashes {
+		sess.flashes[key] = &flashMessage{value: value}
+	}
+
+	if isNew && s.config.Lazy {
+		// the cookie is not sent until the first write.
+		sess.pending = func(context.Context) {
+			s.provider.metrics.SessionCreated()
+			fireSession(s.provider.hooks.create, sess)
+		}
+	}
+
+	if s.config.AbsoluteTimeout > 0 {
+		sess.created = created
+		sess.Lifetime.absolute = created.Add(s.config.AbsoluteTimeout)
+		if isNew {
+			s.provider.saveCreated(ctx, sess)
+		}
+	}
+
+	if isNew {
+		expires := s.config.Expires
+		if s.config.IdleTimeout > 0 {
+			expires = s.config.IdleTimeout
+		}
+
+		if expires = sess.Lifetime.limit(expires); expires > 0 {
+			sess.Lifetime.Time = time.Now().Add(expires)
+		}
+	} else {
+		s.provider.touch(ctx, sess)
+	}
+
+	if isNew && !s.config.Lazy {
+		s.provider.metrics.SessionCreated()
+		fireSession(s.provider.hooks.create, sess)
+	}
+
+	s.replaceInContext(ctx, sess)
+	return sess
+}
+
+// regenerate moves the client-side session under the "newSid",
+// the old session id is revoked.
+func (db *cookieDatabase) regenerate(ctx context.Context, sess *Session, newSid string) error {
+	oldSid := sess.ID()
+
+	sess.mu.Lock()
+	sess.setID(newSid)
+	sess.mu.Unlock()
+
+	return db.store.revoke(ctx, oldSid, sess.lifetime().Time)
+}
+
+// updateCookieExpiration moves the expiration of the client-side session "sess" by "expires",
+// it can not exceed the absolute timeout.
+func updateCookieExpiration(sess *Session, expires time.Duration) error {
+	if expires <= 0 {
+		return nil
+	}
+
+	if sess.Lifetime.limit(expires) <= 0 {
+		return ErrNotFound
+	}
+
+	sess.Lifetime.Shift(expires)
+	fireSession(sess.provider.hooks.expiration, sess)
+	return nil
+}
@@ -0,0 +1,456 @@
+// Package csrf provides cross-site request forgery protection on top of the go-sessions.
+//
+// Each session gets its own random secret, which is stored as a session value.
+// The tokens that are sent to the client are masked with a fresh one-time pad on every request,
+// so the secret never appears as-is in a response body and it can not be recovered
+// through compression side channels, i.e. the BREACH attack.
+//
+// The `Protector.Handler` and `Protector.HandlerFasthttp` middlewares reject the requests
+// of unsafe methods (all except GET, HEAD, OPTIONS and TRACE) which do not carry a valid token
+// in the `Options.Header` header or the `Options.Field` form field.
+// Use the `Token`, `TemplateField` and `TemplateFuncs` to render the token of the current request.
+package csrf
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+
+	"github.com/kataras/go-sessions/v3"
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	// DefaultHeader is the default request header which carries the token, see `Options.Header`.
+	DefaultHeader = "X-CSRF-Token"
+	// DefaultField is the default form field which carries the token, see `Options.Field`.
+	DefaultField = "csrf_token"
+	// DefaultSessionKey is the default session key of the secret, see `Options.SessionKey`.
+	// It's a reserved key of the sessions manager, so it's not part of the session's values, i.e. on `GetAll`.
+	DefaultSessionKey = "_gosessions.csrf"
+)
+
+// secretLen is the length, in bytes, of a session's secret.
+const secretLen = 32
+
+var (
+	// ErrTokenMissing is the error of a request of an unsafe method without a token.
+	ErrTokenMissing = errors.New("csrf: token is missing")
+	// ErrTokenInvalid is the error of a request of an unsafe method with a token
+	// which does not match the session's secret.
+	ErrTokenInvalid = errors.New("csrf: token is invalid")
+)
+
+// Options holds the configuration of a `Protector`.
+type Options struct {
+	// Sessions is the sessions manager which the secrets are stored to.
+	//
+	// Defaults to the sessions.Default.
+	Sessions *sessions.Sessions
+	// Header is the request header which carries the token, i.e. for AJAX requests.
+	//
+	// Defaults to "X-CSRF-Token".
+	Header string
+	// Field is the form field which carries the token, see `TemplateField`.
+	//
+	// Defaults to "csrf_token".
+	Field string
+	// SessionKey is the session key which the secret is stored to.
+	//
+	// Defaults to "_gosessions.csrf".
+	SessionKey string
+	// ErrorHandler handles the net/http requests which are rejected,
+	// use the `Reason` to retrieve the error.
+	//
+	// Defaults to a 403 Forbidden response.
+	ErrorHandler http.Handler
+	// ErrorHandlerFasthttp handles the valyala/fasthttp requests which are rejected,
+	// use the `ReasonFasthttp` to retrieve the error.
+	//
+	// Defaults to a 403 Forbidden response.
+	ErrorHandlerFasthttp fasthttp.RequestHandler
+}
+
+// Protector generates and validates the tokens of the sessions.
+type Protector struct {
+	opts Options
+}
+
+// New returns a new `Protector` based on the "opts".
+func New(opts Options) *Protector {
+	if opts.Sessions == nil {
+		opts.Sessions = sessions.Default
+	}
+
+	if opts.Header == "" {
+		opts.Header = DefaultHeader
+	}
+
+	if opts.Field == "" {
+		opts.Field = DefaultField
+	}
+
+	if opts.SessionKey == "" {
+		opts.SessionKey = DefaultSessionKey
+	}
+
+	if opts.ErrorHandler == nil {
+		opts.ErrorHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		})
+	}
+
+	if opts.ErrorHandlerFasthttp == nil {
+		opts.ErrorHandlerFasthttp = func(ctx *fasthttp.RequestCtx) {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusForbidden), fasthttp.StatusForbidden)
+		}
+	}
+
+	return &Protector{opts: opts}
+}
+
+// secret returns the secret of the "sess", a new one is generated and stored on its first use.
+func (p *Protector) secret(ctx context.Context, sess *sessions.Session) ([]byte, error) {
+	encoded, err := p.storedSecret(ctx, sess)
+	if err != nil {
+		return nil, err
+	}
+
+	if encoded == "" {
+		if encoded, err = p.generateSecret(ctx, sess); err != nil {
+			return nil, err
+		}
+	}
+
+	secret, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(secret) != secretLen {
+		return nil, fmt.Errorf("csrf: malformed secret of session %s", sess.ID())
+	}
+
+	return secret, nil
+}
+
+// storedSecret returns the encoded secret of the "sess" or an empty string if it's not generated yet.
+func (p *Protector) storedSecret(ctx context.Context, sess *sessions.Session) (string, error) {
+	v, err := sess.GetE(ctx, p.opts.SessionKey)
+	if err != nil {
+		if err == sessions.ErrNotFound {
+			return "", nil
+		}
+
+		return "", err
+	}
+
+	encoded, _ := v.(string)
+	return encoded, nil
+}
+
+// generateSecret stores a new secret to the "sess" and it returns its encoded form,
+// the secret of a concurrent request of the same session, if any, is kept instead.
+func (p *Protector) generateSecret(ctx context.Context, sess *sessions.Session) (string, error) {
+	var encoded string
+	err := sess.UpdateContext(ctx, func(tx *sessions.SessionTx) error {
+		if v, ok := tx.Get(p.opts.SessionKey).(string); ok && v != "" {
+			encoded = v
+			return nil
+		}
+
+		secret := make([]byte, secretLen)
+		if _, err := rand.Read(secret); err != nil {
+			return err
+		}
+
+		// as string, so any database encoder can keep it as it's.
+		encoded = base64.RawURLEncoding.EncodeToString(secret)
+		return tx.Set(p.opts.SessionKey, encoded)
+	})
+
+	return encoded, err
+}
+
+// NewToken returns a fresh masked token of the "sess",
+// useful when the middlewares are not used, i.e. to send a token through a JSON response.
+func (p *Protector) NewToken(ctx context.Context, sess *sessions.Session) (string, error) {
+	secret, err := p.secret(ctx, sess)
+	if err != nil {
+		return "", err
+	}
+
+	return mask(secret)
+}
+
+// Verify validates the "token" against the secret of the "sess",
+// it returns the `ErrTokenMissing` or the `ErrTokenInvalid` if it's not valid.
+func (p *Protector) Verify(ctx context.Context, sess *sessions.Session, token string) error {
+	secret, err := p.secret(ctx, sess)
+	if err != nil {
+		return err
+	}
+
+	return verify(secret, token)
+}
+
+// Reset removes the secret of the "sess", so the tokens issued so far are not valid anymore.
+// Call it right after a privilege change, i.e. login or logout.
+func (p *Protector) Reset(sess *sessions.Session) {
+	sess.Delete(p.opts.SessionKey)
+}
+
+// mask returns the token of the "secret", a random one-time pad followed by the secret xor-ed with it.
+func mask(secret []byte) (string, error) {
+	token := make([]byte, 2*secretLen)
+	otp := token[:secretLen]
+	if _, err := rand.Read(otp); err != nil {
+		return "", err
+	}
+
+	for i, b := range secret {
+		token[secretLen+i] = b ^ otp[i]
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+// verify reports whether the "token" is a masked token of the "secret".
+func verify(secret []byte, token string) error {
+	if token == "" {
+		return ErrTokenMissing
+	}
+
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(decoded) != 2*secretLen {
+		return ErrTokenInvalid
+	}
+
+	unmasked := make([]byte, secretLen)
+	for i := range unmasked {
+		unmasked[i] = decoded[i] ^ decoded[secretLen+i]
+	}
+
+	if subtle.ConstantTimeCompare(unmasked, secret) != 1 {
+		return ErrTokenInvalid
+	}
+
+	return nil
+}
+
+// isSafe reports whether the "method" does not change the state of the server, per RFC 9110.
+func isSafe(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	default:
+		return false
+	}
+}
+
+// requestState is the token and the rejection reason of a request, see `Token` and `Reason`.
+type requestState struct {
+	token  string
+	field  string
+	reason error
+}
+
+type contextKey struct{}
+
+// userValueKey is the valyala/fasthttp user value key of the `requestState`.
+const userValueKey = "csrf.state"
+
+func stateOf(ctx context.Context) *requestState {
+	state, _ := ctx.Value(contextKey{}).(*requestState)
+	return state
+}
+
+func stateOfFasthttp(ctx *fasthttp.RequestCtx) *requestState {
+	state, _ := ctx.UserValue(userValueKey).(*requestState)
+	return state
+}
+
+// requestToken returns the token of the net/http request, from the header or the form field.
+func (p *Protector) requestToken(r *http.Request) string {
+	if token := r.Header.Get(p.opts.Header); token != "" {
+		return token
+	}
+
+	return r.PostFormValue(p.opts.Field)
+}
+
+// requestTokenFasthttp returns the token of the valyala/fasthttp request, from the header or the form field.
+func (p *Protector) requestTokenFasthttp(ctx *fasthttp.RequestCtx) string {
+	if token := ctx.Request.Header.Peek(p.opts.Header); len(token) > 0 {
+		return string(token)
+	}
+
+	if token := ctx.PostArgs().Peek(p.opts.Field); len(token) > 0 {
+		return string(token)
+	}
+
+	if form, err := ctx.MultipartForm(); err == nil {
+		if values := form.Value[p.opts.Field]; len(values) > 0 {
+			return values[0]
+		}
+	}
+
+	return ""
+}
+
+// Handler returns a net/http middleware which rejects the requests of unsafe methods
+// without a valid token, through the `Options.ErrorHandler`.
+// The token of the current request is available to the "next" handler through the `Token`.
+//
+// It can be registered under the sessions' `Handler` middleware or on its own.
+func (p *Protector) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess := p.opts.Sessions.Start(w, r)
+		secret, err := p.secret(r.Context(), sess)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		state := &requestState{field: p.opts.Field}
+		r = r.WithContext(context.WithValue(r.Context(), contextKey{}, state))
+
+		if !isSafe(r.Method) {
+			if state.reason = verify(secret, p.requestToken(r)); state.reason != nil {
+				p.opts.ErrorHandler.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		if state.token, err = mask(secret); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+
+		// the response depends on the session.
+		w.Header().Add("Vary", "Cookie")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// HandlerFasthttp returns a valyala/fasthttp middleware which rejects the requests of unsafe methods
+// without a valid token, through the `Options.ErrorHandlerFasthttp`.
+// The token of the current request is available to the "next" handler through the `TokenFasthttp`.
+//
+// It can be registered under the sessions' `HandlerFasthttp` middleware or on its own.
+func (p *Protector) HandlerFasthttp(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		sess := p.opts.Sessions.StartFasthttp(ctx)
+		secret, err := p.secret(ctx, sess)
+		if err != nil {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
+			return
+		}
+
+		state := &requestState{field: p.opts.Field}
+		ctx.SetUserValue(userValueKey, state)
+
+		if !isSafe(string(ctx.Method())) {
+			if state.reason = verify(secret, p.requestTokenFasthttp(ctx)); state.reason != nil {
+				p.opts.ErrorHandlerFasthttp(ctx)
+				return
+			}
+		}
+
+		if state.token, err = mask(secret); err != nil {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
+			return
+		}
+
+		// the response depends on the session.
+		ctx.Response.Header.Add("Vary", "Cookie")
+		next(ctx)
+	}
+}
+
+// Token returns the masked token of the net/http request, it's empty
+// if the request is not served by the `Protector.Handler`.
+// Send it back through the `Options.Header` header or the `Options.Field` form field.
+func Token(r *http.Request) string {
+	if state := stateOf(r.Context()); state != nil {
+		return state.token
+	}
+
+	return ""
+}
+
+// TokenFasthttp returns the masked token of the valyala/fasthttp request, it's empty
+// if the request is not served by the `Protector.HandlerFasthttp`.
+// Send it back through the `Options.Header` header or the `Options.Field` form field.
+func TokenFasthttp(ctx *fasthttp.RequestCtx) string {
+	if state := stateOfFasthttp(ctx); state != nil {
+		return state.token
+	}
+
+	return ""
+}
+
+// Reason returns the error of a net/http request which is rejected by the `Protector.Handler`,
+// i.e. inside the `Options.ErrorHandler`.
+func Reason(r *http.Request) error {
+	if state := stateOf(r.Context()); state != nil {
+		return state.reason
+	}
+
+	return nil
+}
+
+// ReasonFasthttp returns the error of a valyala/fasthttp request which is rejected
+// by the `Protector.HandlerFasthttp`, i.e. inside the `Options.ErrorHandlerFasthttp`.
+func ReasonFasthttp(ctx *fasthttp.RequestCtx) error {
+	if state := stateOfFasthttp(ctx); state != nil {
+		return state.reason
+	}
+
+	return nil
+}
+
+func field(state *requestState) template.HTML {
+	if state == nil {
+		return ""
+	}
+
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+		template.HTMLEscapeString(state.field), template.HTMLEscapeString(state.token)))
+}
+
+// TemplateField returns the hidden input of the token of the net/http request, to be rendered inside a form.
+func TemplateField(r *http.Request) template.HTML {
+	return field(stateOf(r.Context()))
+}
+
+// TemplateFieldFasthttp returns the hidden input of the token of the valyala/fasthttp request,
+// to be rendered inside a form.
+func TemplateFieldFasthttp(ctx *fasthttp.RequestCtx) template.HTML {
+	return field(stateOfFasthttp(ctx))
+}
+
+// TemplateFuncs returns the template functions of the net/http request,
+// the "csrfToken" renders the token and the "csrfField" renders its hidden input.
+// The functions should be known before the template is parsed
+// and they should be bound to the request on a clone of the shared template,
+// as the `Funcs` changes the template itself, i.e.
+//
+//	tmpl := template.Must(template.New("form").Funcs(csrf.TemplateFuncs(nil)).Parse(`{{ csrfField }}`))
+//	// inside a handler:
+//	template.Must(tmpl.Clone()).Funcs(csrf.TemplateFuncs(r)).Execute(w, data)
+func TemplateFuncs(r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": func() string { return Token(r) },
+		"csrfField": func() template.HTML { return TemplateField(r) },
+	}
+}
+
+// TemplateFuncsFasthttp same as `TemplateFuncs` but for a valyala/fasthttp request.
+func TemplateFuncsFasthttp(ctx *fasthttp.RequestCtx) template.FuncMap {
+	return template.FuncMap{
+		"csrfToken": func() string { return TokenFasthttp(ctx) },
+		"csrfField": func() template.HTML { return TemplateFieldFasthttp(ctx) },
+	}
+}
@@ -0,0 +1,75 @@
+package csrf
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/kataras/go-sessions/v3"
+)
+
+func TestHandler(t *testing.T) {
+	manager := sessions.New(sessions.Config{})
+	protector := New(Options{Sessions: manager})
+
+	var token string
+	handler := protector.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = Token(r)
+	}))
+
+	serve := func(r *http.Request, cookies []*http.Cookie) *httptest.ResponseRecorder {
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := serve(httptest.NewRequest(http.MethodGet, "/", nil), nil)
+	cookies := rec.Result().Cookies()
+	first := token
+	if rec.Code != http.StatusOK || first == "" || len(cookies) != 1 {
+		t.Fatalf("expected a token and a session cookie but got %d, %q", rec.Code, first)
+	}
+
+	if values := manager.Lookup(cookies[0].Value).GetAll(); len(values) != 0 {
+		t.Fatalf("expected the secret to not be part of the session's values but got %v", values)
+	}
+
+	serve(httptest.NewRequest(http.MethodGet, "/", nil), cookies)
+	if token == first {
+		t.Fatalf("expected a fresh masked token on each request")
+	}
+
+	if rec = serve(httptest.NewRequest(http.MethodPost, "/", nil), cookies); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 Forbidden for a missing token but got %d", rec.Code)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set(DefaultHeader, first)
+	if rec = serve(r, cookies); rec.Code != http.StatusOK {
+		t.Fatalf("expected a previous token of the session to be valid but got %d", rec.Code)
+	}
+
+	form := url.Values{DefaultField: {token}}
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if rec = serve(r, cookies); rec.Code != http.StatusOK {
+		t.Fatalf("expected the form field token to be valid but got %d", rec.Code)
+	}
+
+	// a token of another session.
+	r = httptest.NewRequest(http.MethodPost, "/", nil)
+	r.Header.Set(DefaultHeader, first)
+	if rec = serve(r, nil); rec.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 Forbidden for a token of another session but got %d", rec.Code)
+	}
+
+	if err := verify(make([]byte, secretLen), first); err != ErrTokenInvalid {
+		t.Fatalf("expected ErrTokenInvalid but got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package sessions
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
@@ -13,6 +14,7 @@ var ErrNotImplemented = errors.New("not implemented yet")
 // Database is the interface which all session databases should implement
 // By design it doesn't support any type of cookie session like other frameworks.
 // I want to protect you, believe me.
+// If you really need client-side sessions, i.e. for stateless services, see the opt-in `CookieStore`.
 // The scope of the database is to store somewhere the sessions in order to
 // keep them after restarting the server, nothing more.
 //
@@ -50,67 +52,286 @@ type Database interface {
 	Release(sid string)
 }
 
+// Exister is an optional interface that a session database can implement
+// in order to report whether a session entry exists, it's used by the `Config.Strict` mode.
+// When a database does not implement it, a session entry exists if it has at least one value.
+type Exister interface {
+	// Exists reports whether a session entry with the given "sid" exists and it's not expired.
+	Exists(ctx context.Context, sid string) (bool, error)
+}
+
+// DatabaseContext is the context-aware version of the `Database` interface.
+// Unlike `Database`, its methods report any failure back to the caller,
+// so a missing entry can be told apart from an unavailable database.
+//
+// All databases of the `sessiondb` folder implement both `Database` and `DatabaseContext`.
+// Register one using `UseDatabase` or `UseDatabaseContext`,
+// databases which implement only the `Database` interface are adapted automatically.
+type DatabaseContext interface {
+	// AcquireContext receives a session's lifetime from the database,
+	// if the return value is LifeTime{} then the session manager sets the life time based on the expiration duration lives in configuration.
+	AcquireContext(ctx context.Context, sid string, expires time.Duration) (LifeTime, error)
+	// OnUpdateExpirationContext should re-set the expiration (ttl) of the session entry inside the database,
+	// it is fired on `ShiftExpiration` and `UpdateExpiration`.
+	//
+	// If a database does not support this feature then an `ErrNotImplemented` should be returned instead.
+	OnUpdateExpirationContext(ctx context.Context, sid string, newExpires time.Duration) error
+	// SetContext sets a key value of a specific session.
+	// The "immutable" input argument depends on the store, it may not implement it at all.
+	SetContext(ctx context.Context, sid string, lifetime LifeTime, key string, value interface{}, immutable bool) error
+	// GetContext retrieves a session value based on the key.
+	// It should return an `ErrNotFound` error if the key does not exist.
+	GetContext(ctx context.Context, sid string, key string) (interface{}, error)
+	// VisitContext loops through all session keys and values.
+	VisitContext(ctx context.Context, sid string, cb func(key string, value interface{})) error
+	// LenContext returns the length of the session's entries (keys).
+	LenContext(ctx context.Context, sid string) (int, error)
+	// DeleteContext removes a session key value based on its key.
+	DeleteContext(ctx context.Context, sid string, key string) (deleted bool, err error)
+	// ClearContext removes all session key values but it keeps the session entry.
+	ClearContext(ctx context.Context, sid string) error
+	// ReleaseContext destroys the session, it clears and removes the session entry,
+	// session manager will create a new session ID on the next request after this call.
+	ReleaseContext(ctx context.Context, sid string) error
+}
+
+// databaseAdapter adapts a `Database` which does not implement the `DatabaseContext` interface.
+// The context is ignored and the only reported error is the `ErrNotFound` on a nil `Get`.
+type databaseAdapter struct {
+	db Database
+}
+
+// newDatabaseContext returns the "db" itself if it implements the `DatabaseContext` interface,
+// otherwise it adapts it.
+func newDatabaseContext(db Database) DatabaseContext {
+	if dbc, ok := db.(DatabaseContext); ok {
+		return dbc
+	}
+
+	return &databaseAdapter{db: db}
+}
+
+func (a *databaseAdapter) AcquireContext(_ context.Context, sid string, expires time.Duration) (LifeTime, error) {
+	return a.db.Acquire(sid, expires), nil
+}
+
+func (a *databaseAdapter) OnUpdateExpirationContext(_ context.Context, sid string, newExpires time.Duration) error {
+	return a.db.OnUpdateExpiration(sid, newExpires)
+}
+
+func (a *databaseAdapter) SetContext(_ context.Context, sid string, lifetime LifeTime, key string, value interface{}, immutable bool) error {
+	a.db.Set(sid, lifetime, key, value, immutable)
+	return nil
+}
+
+func (a *databaseAdapter) GetContext(_ context.Context, sid string, key string) (interface{}, error) {
+	if v := a.db.Get(sid, key); v != nil {
+		return v, nil
+	}
+
+	return nil, ErrNotFound
+}
+
+func (a *databaseAdapter) VisitContext(_ context.Context, sid string, cb func(key string, value interface{})) error {
+	a.db.Visit(sid, cb)
+	return nil
+}
+
+func (a *databaseAdapter) LenContext(_ context.Context, sid string) (int, error) {
+	return a.db.Len(sid), nil
+}
+
+func (a *databaseAdapter) DeleteContext(_ context.Context, sid string, key string) (bool, error) {
+	return a.db.Delete(sid, key), nil
+}
+
+func (a *databaseAdapter) ClearContext(_ context.Context, sid string) error {
+	a.db.Clear(sid)
+	return nil
+}
+
+func (a *databaseAdapter) ReleaseContext(_ context.Context, sid string) error {
+	a.db.Release(sid)
+	return nil
+}
+
 type mem struct {
 	values map[string]*Store
 	mu     sync.RWMutex
 }
 
-var _ Database = (*mem)(nil)
+var (
+	_ DatabaseContext = (*mem)(nil)
+	_ Exister         = (*mem)(nil)
+	_ Iterator        = (*mem)(nil)
+)
 
-func newMemDB() Database { return &mem{values: make(map[string]*Store)} }
+func newMemDB() DatabaseContext { return &mem{values: make(map[string]*Store)} }
 
-func (s *mem) Acquire(sid string, expires time.Duration) LifeTime {
+func (s *mem) AcquireContext(_ context.Context, sid string, expires time.Duration) (LifeTime, error) {
 	s.mu.Lock()
 	s.values[sid] = new(Store)
 	s.mu.Unlock()
-	return LifeTime{}
+	return LifeTime{}, nil
 }
 
 // Do nothing, the `LifeTime` of the Session will be managed by the callers automatically on memory-based storage.
-func (s *mem) OnUpdateExpiration(string, time.Duration) error { return nil }
+func (s *mem) OnUpdateExpirationContext(context.Context, string, time.Duration) error { return nil }
 
 // immutable depends on the store, it may not implement it at all.
-func (s *mem) Set(sid string, lifetime LifeTime, key string, value interface{}, immutable bool) {
+func (s *mem) SetContext(_ context.Context, sid string, lifetime LifeTime, key string, value interface{}, immutable bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store, found := s.values[sid]
+	if !found {
+		return ErrNotFound
+	}
+
+	store.Save(key, value, immutable)
+	return nil
+}
+
+func (s *mem) GetContext(_ context.Context, sid string, key string) (interface{}, error) {
 	s.mu.RLock()
-	s.values[sid].Save(key, value, immutable)
-	s.mu.RUnlock()
+	defer s.mu.RUnlock()
+
+	store, found := s.values[sid]
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	v := store.Get(key)
+	if v == nil {
+		return nil, ErrNotFound
+	}
+
+	return v, nil
 }
 
-func (s *mem) Get(sid string, key string) interface{} {
+func (s *mem) VisitContext(_ context.Context, sid string, cb func(key string, value interface{})) error {
 	s.mu.RLock()
-	v := s.values[sid].Get(key)
+	store, found := s.values[sid]
 	s.mu.RUnlock()
+	if !found {
+		return ErrNotFound
+	}
 
-	return v
+	store.Visit(cb)
+	return nil
 }
 
-func (s *mem) Visit(sid string, cb func(key string, value interface{})) {
-	s.values[sid].Visit(cb)
+func (s *mem) LenContext(_ context.Context, sid string) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	store, found := s.values[sid]
+	if !found {
+		return 0, ErrNotFound
+	}
+
+	return store.Len(), nil
+}
+
+func (s *mem) DeleteContext(_ context.Context, sid string, key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store, found := s.values[sid]
+	if !found {
+		return false, ErrNotFound
+	}
+
+	return store.Remove(key), nil
+}
+
+func (s *mem) ClearContext(_ context.Context, sid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	store, found := s.values[sid]
+	if !found {
+		return ErrNotFound
+	}
+
+	store.Reset()
+	return nil
 }
 
-func (s *mem) Len(sid string) int {
+func (s *mem) Exists(_ context.Context, sid string) (bool, error) {
 	s.mu.RLock()
-	n := s.values[sid].Len()
+	_, found := s.values[sid]
 	s.mu.RUnlock()
+	return found, nil
+}
+
+// isImmutable reports whether the "key" of the session "sid" is stored through the `Session.SetImmutable`.
+func (s *mem) isImmutable(sid string, key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
-	return n
+	store, found := s.values[sid]
+	if !found {
+		return false
+	}
+
+	entry := store.GetEntry(key)
+	return entry != nil && entry.immutable
 }
 
-func (s *mem) Delete(sid string, key string) (deleted bool) {
+// isImmutable reports whether the "key" of the session "sid" is immutable in the "db",
+// only the memory database keeps the immutable entries, see `Session.SetImmutable`.
+func isImmutable(db DatabaseContext, sid string, key string) bool {
+	m, ok := unwrapDatabase(db).(*mem)
+	return ok && m.isImmutable(sid, key)
+}
+
+func (s *mem) IterateContext(_ context.Context, cb func(sid string) bool) error {
 	s.mu.RLock()
-	deleted = s.values[sid].Remove(key)
+	sids := make([]string, 0, len(s.values))
+	for sid := range s.values {
+		sids = append(sids, sid)
+	}
 	s.mu.RUnlock()
-	return
-}
 
-func (s *mem) Clear(sid string) {
-	s.mu.Lock()
-	s.values[sid].Reset()
-	s.mu.Unlock()
+	for _, sid := range sids {
+		if !cb(sid) {
+			break
+		}
+	}
+
+	return nil
 }
 
-func (s *mem) Release(sid string) {
+func (s *mem) ReleaseContext(_ context.Context, sid string) error {
 	s.mu.Lock()
 	delete(s.values, sid)
 	s.mu.Unlock()
+	return nil
+}
+
+// emptyDatabase is the database of a lazy session which is not stored yet,
+// it has no values, see `Config.Lazy`.
+type emptyDatabase struct{}
+
+var _ DatabaseContext = emptyDatabase{}
+
+func (emptyDatabase) AcquireContext(context.Context, string, time.Duration) (LifeTime, error) {
+	return LifeTime{}, nil
+}
+func (emptyDatabase) OnUpdateExpirationContext(context.Context, string, time.Duration) error {
+	return nil
+}
+func (emptyDatabase) SetContext(context.Context, string, LifeTime, string, interface{}, bool) error {
+	return ErrNotFound
+}
+func (emptyDatabase) GetContext(context.Context, string, string) (interface{}, error) {
+	return nil, ErrNotFound
+}
+func (emptyDatabase) VisitContext(context.Context, string, func(string, interface{})) error {
+	return nil
 }
+func (emptyDatabase) LenContext(context.Context, string) (int, error)             { return 0, nil }
+func (emptyDatabase) DeleteContext(context.Context, string, string) (bool, error) { return false, nil }
+func (emptyDatabase) ClearContext(context.Context, string) error                  { return nil }
+func (emptyDatabase) ReleaseContext(context.Context, string) error                { return nil }
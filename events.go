@@ -0,0 +1,234 @@
+package sessions
+
+// DestroyReason describes why a session was destroyed, see `DestroyEvent`.
+type DestroyReason uint8
+
+const (
+	// ReasonDestroy is the reason of a session destroyed through
+	// the `Destroy`, `DestroyFasthttp` or the `Session.Destroy` methods.
+	ReasonDestroy DestroyReason = iota + 1
+	// ReasonDestroyByID is the reason of a session destroyed through the `DestroyByID` method.
+	ReasonDestroyByID
+	// ReasonDestroyAll is the reason of a session destroyed through the `DestroyAll` method.
+	ReasonDestroyAll
+	// ReasonExpired is the reason of a session which its lifetime has ended,
+	// see the `Config.Expires`, `Config.IdleTimeout` and `Config.AbsoluteTimeout` fields.
+	ReasonExpired
+	// ReasonBackendExpired is the reason of a session which its stored lifetime has been found ended
+	// on its load, i.e. its time-to-live has ended while the application was down.
+	// Note that a session removed by the database itself, i.e. by the redis' time-to-live,
+	// is not reported, the databases do not notify the application.
+	ReasonBackendExpired
+	// ReasonDestroyOwner is the reason of a session destroyed through the `DestroyOwner` method.
+	ReasonDestroyOwner
+	// ReasonEvicted is the reason of a session evicted because its owner has reached
+	// the `Config.MaxSessionsPerOwner` limit, see `Config.OwnerLimitPolicy`.
+	ReasonEvicted
+	// ReasonFingerprint is the reason of a session destroyed because it was used by another client,
+	// see `FingerprintDestroy`.
+	ReasonFingerprint
+)
+
+// String returns the text representation of the reason.
+func (r DestroyReason) String() string {
+	switch r {
+	case ReasonDestroy:
+		return "destroy"
+	case ReasonDestroyByID:
+		return "destroy by id"
+	case ReasonDestroyAll:
+		return "destroy all"
+	case ReasonExpired:
+		return "expired"
+	case ReasonBackendExpired:
+		return "backend expired"
+	case ReasonDestroyOwner:
+		return "destroy owner"
+	case ReasonEvicted:
+		return "evicted"
+	case ReasonFingerprint:
+		return "fingerprint mismatch"
+	default:
+		return "unknown"
+	}
+}
+
+// DestroyEvent is the information that a `DestroyEventListener` receives.
+type DestroyEvent struct {
+	// ID is the destroyed session's id.
+	ID string
+	// Reason is the reason that the session was destroyed.
+	Reason DestroyReason
+	// Values is a snapshot of the session's values, taken before they are removed from the database.
+	// It's a copy, modifications do not affect the session.
+	//
+	// Note that it's empty for a client-side session destroyed through the `DestroyByID`,
+	// as its values are known only by the client.
+	Values Store
+}
+
+// DestroyEventListener is the form of a destroy event listener.
+// Look `OnDestroyEvent` for more.
+type DestroyEventListener func(evt DestroyEvent)
+
+// OnDestroyEvent registers one or more destroy event listeners.
+// A destroy event listener is fired when a session has been removed from the server,
+// like the `OnDestroy` listeners, but it receives the reason
+// and a snapshot of the session's values as well, see `DestroyEvent`.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func OnDestroyEvent(listeners ...DestroyEventListener) {
+	Default.OnDestroyEvent(listeners...)
+}
+
+// OnDestroyEvent registers one or more destroy event listeners.
+// A destroy event listener is fired when a session has been removed from the server,
+// like the `OnDestroy` listeners, but it receives the reason
+// and a snapshot of the session's values as well, see `DestroyEvent`.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func (s *Sessions) OnDestroyEvent(listeners ...DestroyEventListener) {
+	for _, ln := range listeners {
+		s.provider.registerDestroyEventListener(ln)
+	}
+}
+
+// SessionListener is the form of the create, load and expiration update listeners.
+// Look `OnCreate`, `OnLoad` and `OnExpirationUpdate` for more.
+type SessionListener func(sess *Session)
+
+// SetListener is the form of a set listener.
+// Look `OnSet` for more.
+type SetListener func(sess *Session, key string, value interface{})
+
+// DeleteListener is the form of a delete listener.
+// Look `OnDelete` for more.
+type DeleteListener func(sess *Session, key string)
+
+// OnCreate registers one or more listeners which are fired when a new session is created,
+// for a lazy session, see `Config.Lazy`, that happens on its first write.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func OnCreate(listeners ...SessionListener) {
+	Default.OnCreate(listeners...)
+}
+
+// OnCreate registers one or more listeners which are fired when a new session is created,
+// for a lazy session, see `Config.Lazy`, that happens on its first write.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func (s *Sessions) OnCreate(listeners ...SessionListener) {
+	s.provider.hooks.create = appendSessionListeners(s.provider.hooks.create, listeners)
+}
+
+// OnLoad registers one or more listeners which are fired when an existing session,
+// which is not in memory, is read back from the registered database, i.e. after a restart.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func OnLoad(listeners ...SessionListener) {
+	Default.OnLoad(listeners...)
+}
+
+// OnLoad registers one or more listeners which are fired when an existing session,
+// which is not in memory, is read back from the registered database, i.e. after a restart.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func (s *Sessions) OnLoad(listeners ...SessionListener) {
+	s.provider.hooks.load = appendSessionListeners(s.provider.hooks.load, listeners)
+}
+
+// OnSet registers one or more listeners which are fired after a session's value is stored.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func OnSet(listeners ...SetListener) {
+	Default.OnSet(listeners...)
+}
+
+// OnSet registers one or more listeners which are fired after a session's value is stored.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func (s *Sessions) OnSet(listeners ...SetListener) {
+	for _, ln := range listeners {
+		if ln != nil {
+			s.provider.hooks.set = append(s.provider.hooks.set, ln)
+		}
+	}
+}
+
+// OnDelete registers one or more listeners which are fired after a session's value is removed,
+// a `Clear` fires them for each one of the removed keys.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func OnDelete(listeners ...DeleteListener) {
+	Default.OnDelete(listeners...)
+}
+
+// OnDelete registers one or more listeners which are fired after a session's value is removed,
+// a `Clear` fires them for each one of the removed keys.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func (s *Sessions) OnDelete(listeners ...DeleteListener) {
+	for _, ln := range listeners {
+		if ln != nil {
+			s.provider.hooks.delete = append(s.provider.hooks.delete, ln)
+		}
+	}
+}
+
+// OnExpirationUpdate registers one or more listeners which are fired after a session's expiration is moved,
+// through the `ShiftExpiration` and `UpdateExpiration` methods or the
+// `Config.SlidingExpiration` and `Config.IdleTimeout` fields.
+// The new expiration is the session's `Lifetime`.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func OnExpirationUpdate(listeners ...SessionListener) {
+	Default.OnExpirationUpdate(listeners...)
+}
+
+// OnExpirationUpdate registers one or more listeners which are fired after a session's expiration is moved,
+// through the `ShiftExpiration` and `UpdateExpiration` methods or the
+// `Config.SlidingExpiration` and `Config.IdleTimeout` fields.
+// The new expiration is the session's `Lifetime`.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func (s *Sessions) OnExpirationUpdate(listeners ...SessionListener) {
+	s.provider.hooks.expiration = appendSessionListeners(s.provider.hooks.expiration, listeners)
+}
+
+func appendSessionListeners(dest []SessionListener, listeners []SessionListener) []SessionListener {
+	for _, ln := range listeners {
+		if ln != nil {
+			dest = append(dest, ln)
+		}
+	}
+
+	return dest
+}
+
+// hooks holds the lifecycle listeners of a provider.
+type hooks struct {
+	create      []SessionListener
+	load        []SessionListener
+	set         []SetListener
+	delete      []DeleteListener
+	expiration  []SessionListener
+	fingerprint []SessionListener
+}
+
+func fireSession(listeners []SessionListener, sess *Session) {
+	for _, ln := range listeners {
+		ln(sess)
+	}
+}
+
+func (h *hooks) fireSet(sess *Session, key string, value interface{}) {
+	for _, ln := range h.set {
+		ln(sess, key, value)
+	}
+}
+
+func (h *hooks) fireDelete(sess *Session, key string) {
+	for _, ln := range h.delete {
+		ln(sess, key)
+	}
+}
@@ -0,0 +1,371 @@
+package sessions
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/valyala/fasthttp"
+)
+
+// fingerprintKey is the reserved key of the client's fingerprint that the session is bound to,
+// see `Config.Fingerprint`.
+const fingerprintKey = reservedKeyPrefix + "fingerprint"
+
+// Fingerprinter extracts the fingerprint of the client from a request,
+// a session is bound to the fingerprint of the client which created it, see `Config.Fingerprint`.
+//
+// Builtin fingerprinters are the `UserAgentFingerprint`, the `IPFingerprint`,
+// the `TLSFingerprint` and the `CustomFingerprint`, use the `Fingerprints` to combine them.
+type Fingerprinter interface {
+	// Fingerprint returns the fingerprint of the client of the net/http request.
+	Fingerprint(r *http.Request) string
+	// FingerprintFasthttp returns the fingerprint of the client of the valyala/fasthttp request.
+	FingerprintFasthttp(ctx *fasthttp.RequestCtx) string
+}
+
+// FingerprintPolicy decides how a request with a different fingerprint than
+// the one that its session is bound to is handled, see `Config.Fingerprint`.
+type FingerprintPolicy uint8
+
+const (
+	// FingerprintReject discards the session for that request, a fresh session is started instead,
+	// the original session is kept for its owner.
+	FingerprintReject FingerprintPolicy = iota
+	// FingerprintDestroy destroys the session as stolen, a fresh session is started instead,
+	// so the session can not be used by anyone anymore, its owner has to log in again.
+	FingerprintDestroy
+	// FingerprintReport accepts the session, the mismatch is only reported
+	// to the `OnFingerprintMismatch` listeners.
+	FingerprintReport
+)
+
+// UserAgentFingerprint is a `Fingerprinter` of the client's User-Agent request header.
+type UserAgentFingerprint struct{}
+
+var _ Fingerprinter = UserAgentFingerprint{}
+
+// Fingerprint returns the User-Agent header of the net/http request.
+func (UserAgentFingerprint) Fingerprint(r *http.Request) string {
+	return r.UserAgent()
+}
+
+// FingerprintFasthttp returns the User-Agent header of the valyala/fasthttp request.
+func (UserAgentFingerprint) FingerprintFasthttp(ctx *fasthttp.RequestCtx) string {
+	return string(ctx.UserAgent())
+}
+
+// IPFingerprint is a `Fingerprinter` of the client's network,
+// the client's IP address masked by a prefix length, e.g. 203.0.113.0/24,
+// so a client which moves inside its network keeps its session.
+type IPFingerprint struct {
+	// TrustedProxies are the networks of the reverse proxies in front of the application.
+	// The client's IP address is read from the X-Forwarded-For header
+	// only when the request comes from one of them, otherwise the header is ignored.
+	TrustedProxies []*net.IPNet
+	// IPv4PrefixLen is the prefix length of an IPv4 address.
+	//
+	// Defaults to 24.
+	IPv4PrefixLen int
+	// IPv6PrefixLen is the prefix length of an IPv6 address.
+	//
+	// Defaults to 64.
+	IPv6PrefixLen int
+}
+
+var _ Fingerprinter = (*IPFingerprint)(nil)
+
+// NewIPFingerprint returns a new `IPFingerprint` which trusts the X-Forwarded-For header
+// of the "trustedProxies", each one is an IP address or a network in CIDR notation, e.g. "10.0.0.0/8".
+func NewIPFingerprint(trustedProxies ...string) (*IPFingerprint, error) {
+	f := new(IPFingerprint)
+
+	for _, proxy := range trustedProxies {
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+
+		_, network, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, err
+		}
+
+		f.TrustedProxies = append(f.TrustedProxies, network)
+	}
+
+	return f, nil
+}
+
+func (f *IPFingerprint) isTrusted(ip net.IP) bool {
+	for _, network := range f.TrustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIP returns the client's IP address of a request that comes from the "remoteIP",
+// the X-Forwarded-For values are read from right to left, while they are added by a trusted proxy.
+func (f *IPFingerprint) clientIP(remoteIP net.IP, forwardedFor []string) net.IP {
+	ip := remoteIP
+	if ip == nil || !f.isTrusted(ip) {
+		return ip
+	}
+
+	var hops []string
+	for _, value := range forwardedFor {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil { // malformed, the last valid one is the client.
+			break
+		}
+
+		ip = hop
+		if !f.isTrusted(ip) {
+			break
+		}
+	}
+
+	return ip
+}
+
+// network returns the "ip" masked by the prefix length.
+func (f *IPFingerprint) network(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+
+	var mask net.IPMask
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+		prefixLen := f.IPv4PrefixLen
+		if prefixLen <= 0 || prefixLen > 32 {
+			prefixLen = 24
+		}
+		mask = net.CIDRMask(prefixLen, 32)
+	} else {
+		prefixLen := f.IPv6PrefixLen
+		if prefixLen <= 0 || prefixLen > 128 {
+			prefixLen = 64
+		}
+		mask = net.CIDRMask(prefixLen, 128)
+	}
+
+	network := net.IPNet{IP: ip.Mask(mask), Mask: mask}
+	return network.String()
+}
+
+// Fingerprint returns the network of the client of the net/http request.
+func (f *IPFingerprint) Fingerprint(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return f.network(f.clientIP(net.ParseIP(host), r.Header.Values("X-Forwarded-For")))
+}
+
+// FingerprintFasthttp returns the network of the client of the valyala/fasthttp request.
+func (f *IPFingerprint) FingerprintFasthttp(ctx *fasthttp.RequestCtx) string {
+	var forwardedFor []string
+	for _, value := range ctx.Request.Header.PeekAll("X-Forwarded-For") {
+		forwardedFor = append(forwardedFor, string(value))
+	}
+
+	return f.network(f.clientIP(ctx.RemoteIP(), forwardedFor))
+}
+
+// TLSFingerprint is a `Fingerprinter` of the client's TLS certificate,
+// the SHA-256 hash of the certificate which the client presented on mutual TLS.
+type TLSFingerprint struct{}
+
+var _ Fingerprinter = TLSFingerprint{}
+
+func certificateHash(state *tls.ConnectionState) string {
+	if state == nil || len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	sum := sha256.Sum256(state.PeerCertificates[0].Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// Fingerprint returns the hash of the client's certificate of the net/http request.
+func (TLSFingerprint) Fingerprint(r *http.Request) string {
+	return certificateHash(r.TLS)
+}
+
+// FingerprintFasthttp returns the hash of the client's certificate of the valyala/fasthttp request.
+func (TLSFingerprint) FingerprintFasthttp(ctx *fasthttp.RequestCtx) string {
+	return certificateHash(ctx.TLSConnectionState())
+}
+
+// CustomFingerprint is a `Fingerprinter` of custom extractors,
+// i.e. a device id header of a mobile application.
+type CustomFingerprint struct {
+	// Get returns the fingerprint of the client of the net/http request.
+	Get func(r *http.Request) string
+	// GetFasthttp returns the fingerprint of the client of the valyala/fasthttp request.
+	GetFasthttp func(ctx *fasthttp.RequestCtx) string
+}
+
+var _ Fingerprinter = CustomFingerprint{}
+
+// Fingerprint calls the Get field, if any.
+func (f CustomFingerprint) Fingerprint(r *http.Request) string {
+	if f.Get == nil {
+		return ""
+	}
+
+	return f.Get(r)
+}
+
+// FingerprintFasthttp calls the GetFasthttp field, if any.
+func (f CustomFingerprint) FingerprintFasthttp(ctx *fasthttp.RequestCtx) string {
+	if f.GetFasthttp == nil {
+		return ""
+	}
+
+	return f.GetFasthttp(ctx)
+}
+
+// Fingerprints returns a `Fingerprinter` which combines the "fingerprinters",
+// a session is bound to all of them, i.e. the User-Agent and the IP network of the client.
+func Fingerprints(fingerprinters ...Fingerprinter) Fingerprinter {
+	return fingerprints(fingerprinters)
+}
+
+type fingerprints []Fingerprinter
+
+func (f fingerprints) Fingerprint(r *http.Request) string {
+	values := make([]string, 0, len(f))
+	for _, fingerprinter := range f {
+		values = append(values, fingerprinter.Fingerprint(r))
+	}
+
+	return strings.Join(values, "\n")
+}
+
+func (f fingerprints) FingerprintFasthttp(ctx *fasthttp.RequestCtx) string {
+	values := make([]string, 0, len(f))
+	for _, fingerprinter := range f {
+		values = append(values, fingerprinter.FingerprintFasthttp(ctx))
+	}
+
+	return strings.Join(values, "\n")
+}
+
+// fingerprint returns the client's fingerprint of the net/http request, if the `Config.Fingerprint` is set.
+func (s *Sessions) fingerprint(r *http.Request) string {
+	if s.config.Fingerprint == nil {
+		return ""
+	}
+
+	return s.config.Fingerprint.Fingerprint(r)
+}
+
+// fingerprintFasthttp returns the client's fingerprint of the valyala/fasthttp request,
+// if the `Config.Fingerprint` is set.
+func (s *Sessions) fingerprintFasthttp(ctx *fasthttp.RequestCtx) string {
+	if s.config.Fingerprint == nil {
+		return ""
+	}
+
+	return s.config.Fingerprint.FingerprintFasthttp(ctx)
+}
+
+// hashFingerprint returns the stored form of a fingerprint,
+// the fingerprint itself, i.e. an IP network, is not stored.
+func hashFingerprint(fingerprint string) string {
+	sum := sha256.Sum256([]byte(fingerprint))
+	return hex.EncodeToString(sum[:])
+}
+
+// bindFingerprint binds the "sess" to the client's "fingerprint".
+func (s *Sessions) bindFingerprint(ctx context.Context, sess *Session, fingerprint string) {
+	if s.config.Fingerprint == nil {
+		return
+	}
+
+	sess.database().SetContext(ctx, sess.ID(), sess.lifetime(), fingerprintKey, hashFingerprint(fingerprint), false)
+}
+
+// verifyFingerprint compares the client's "fingerprint" with the one that the "sess" is bound to,
+// a session which is not bound yet, i.e. created before the `Config.Fingerprint` was set, is bound to it.
+// It reports whether the session can be used by the client.
+func (s *Sessions) verifyFingerprint(ctx context.Context, sess *Session, fingerprint string) bool {
+	if s.config.Fingerprint == nil {
+		return true
+	}
+
+	v, err := sess.database().GetContext(ctx, sess.ID(), fingerprintKey)
+	if err == ErrNotFound {
+		s.bindFingerprint(ctx, sess, fingerprint)
+		return true
+	}
+
+	if err != nil { // i.e. a database failure, the binding can not be checked.
+		return s.config.FingerprintPolicy == FingerprintReport
+	}
+
+	stored, _ := v.(string)
+	if subtle.ConstantTimeCompare([]byte(stored), []byte(hashFingerprint(fingerprint))) == 1 {
+		return true
+	}
+
+	fireSession(s.provider.hooks.fingerprint, sess)
+
+	switch s.config.FingerprintPolicy {
+	case FingerprintDestroy:
+		s.provider.deleteSession(sess, ReasonFingerprint)
+		return false
+	case FingerprintReport:
+		return true
+	default:
+		return false
+	}
+}
+
+// fingerprintVerifier returns the `verifyFingerprint` of the client's "fingerprint"
+// for the `provider.Read`, it returns nil if the `Config.Fingerprint` is missing.
+func (s *Sessions) fingerprintVerifier(ctx context.Context, fingerprint string) func(*Session) bool {
+	if s.config.Fingerprint == nil {
+		return nil
+	}
+
+	return func(sess *Session) bool {
+		return s.verifyFingerprint(ctx, sess, fingerprint)
+	}
+}
+
+// OnFingerprintMismatch registers one or more listeners which are fired when a session is used by a client
+// with a different fingerprint than the one that the session is bound to, i.e. a stolen session id,
+// before the `Config.FingerprintPolicy` is applied.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func OnFingerprintMismatch(listeners ...SessionListener) {
+	Default.OnFingerprintMismatch(listeners...)
+}
+
+// OnFingerprintMismatch registers one or more listeners which are fired when a session is used by a client
+// with a different fingerprint than the one that the session is bound to, i.e. a stolen session id,
+// before the `Config.FingerprintPolicy` is applied.
+// Note that if a listener is blocking, then the session manager will delay respectfully,
+// use a goroutine inside the listener to avoid that behavior.
+func (s *Sessions) OnFingerprintMismatch(listeners ...SessionListener) {
+	s.provider.hooks.fingerprint = appendSessionListeners(s.provider.hooks.fingerprint, listeners)
+}
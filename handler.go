@@ -0,0 +1,281 @@
+package sessions
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/valyala/fasthttp"
+)
+
+type sessionContextKey struct{}
+
+// requestSession is the value that the `Handler` and `WithSession` store to the request's context.
+type requestSession struct {
+	// manager is the sessions manager which started the session through a middleware, if any.
+	manager *Sessions
+	mu      sync.Mutex
+	sess    *Session
+}
+
+func (rs *requestSession) get() *Session {
+	rs.mu.Lock()
+	sess := rs.sess
+	rs.mu.Unlock()
+	return sess
+}
+
+func (rs *requestSession) set(sess *Session) {
+	rs.mu.Lock()
+	rs.sess = sess
+	rs.mu.Unlock()
+}
+
+func getRequestSession(ctx context.Context) *requestSession {
+	rs, _ := ctx.Value(sessionContextKey{}).(*requestSession)
+	return rs
+}
+
+// Handler returns a net/http middleware which starts the session once per request
+// and stores it to the request's context, so the next handlers
+// can retrieve it through the package-level `FromContext` function.
+//
+// Any `Start` call of the same manager under this middleware returns the same session,
+// so the session's cookie is sent once.
+//
+// A client-side session, see `UseCookieStore`, and the id of a lazy session, see `Config.Lazy`,
+// are sent to the client right before the response is written.
+// The buffered changes of a session, see `Config.WriteBehind`, are written to the database
+// right before the response is written and once more when the "next" handler returns.
+func Handler(next http.Handler) http.Handler {
+	return Default.Handler(next)
+}
+
+// Handler returns a net/http middleware which starts the session once per request
+// and stores it to the request's context, so the next handlers
+// can retrieve it through the package-level `FromContext` function.
+//
+// Any `Start` call of the same manager under this middleware returns the same session,
+// so the session's cookie is sent once.
+//
+// A client-side session, see `UseCookieStore`, and the id of a lazy session, see `Config.Lazy`,
+// are sent to the client right before the response is written.
+// The buffered changes of a session, see `Config.WriteBehind`, are written to the database
+// right before the response is written and once more when the "next" handler returns.
+func (s *Sessions) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rs := &requestSession{manager: s}
+		r = r.WithContext(context.WithValue(r.Context(), sessionContextKey{}, rs))
+		rs.set(s.Start(w, r))
+
+		if s.cookies == nil && !s.config.Lazy && !s.config.WriteBehind {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		rw := &responseWriter{ResponseWriter: w}
+		rw.beforeWrite = func() {
+			s.beforeResponse(w, r, rs.get())
+		}
+
+		next.ServeHTTP(rw, r)
+		rw.before() // nothing was written by the handler.
+
+		if sess := rs.get(); sess != nil { // changes after the response was written.
+			sess.CommitContext(r.Context())
+		}
+	})
+}
+
+// HandlerFasthttp returns a valyala/fasthttp middleware which starts the session once per request
+// and stores it to the request's user values, so the next handlers
+// can retrieve it through the package-level `FromContext` function.
+//
+// Any `StartFasthttp` call of the same manager under this middleware returns the same session,
+// so the session's cookie is sent once.
+//
+// A client-side session, see `UseCookieStore`, and the id of a lazy session, see `Config.Lazy`,
+// are sent to the client after the "next" handler.
+// The buffered changes of a session, see `Config.WriteBehind`, are written to the database after the "next" handler too.
+func HandlerFasthttp(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return Default.HandlerFasthttp(next)
+}
+
+// HandlerFasthttp returns a valyala/fasthttp middleware which starts the session once per request
+// and stores it to the request's user values, so the next handlers
+// can retrieve it through the package-level `FromContext` function.
+//
+// Any `StartFasthttp` call of the same manager under this middleware returns the same session,
+// so the session's cookie is sent once.
+//
+// A client-side session, see `UseCookieStore`, and the id of a lazy session, see `Config.Lazy`,
+// are sent to the client after the "next" handler.
+// The buffered changes of a session, see `Config.WriteBehind`, are written to the database after the "next" handler too.
+func (s *Sessions) HandlerFasthttp(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		rs := &requestSession{manager: s}
+		ctx.SetUserValue(sessionContextKey{}, rs)
+		rs.set(s.StartFasthttp(ctx))
+
+		next(ctx)
+
+		s.beforeResponseFasthttp(ctx, rs.get())
+	}
+}
+
+// beforeResponse sends the client-side session or the id of a stored lazy session, if any,
+// and it writes the buffered changes of the session, see `Config.WriteBehind`.
+func (s *Sessions) beforeResponse(w http.ResponseWriter, r *http.Request, sess *Session) {
+	if s.cookies != nil {
+		s.commitOnResponse(w, r, sess)
+		return
+	}
+
+	if sess == nil {
+		return
+	}
+
+	sess.CommitContext(r.Context())
+
+	if sess.takeIDPending() {
+		s.updateSessionID(w, r, sess.ID(), s.config.Expires)
+	}
+}
+
+// beforeResponseFasthttp sends the client-side session or the id of a stored lazy session, if any,
+// and it writes the buffered changes of the session, see `Config.WriteBehind`.
+func (s *Sessions) beforeResponseFasthttp(ctx *fasthttp.RequestCtx, sess *Session) {
+	if s.cookies != nil {
+		s.commitOnResponseFasthttp(ctx, sess)
+		return
+	}
+
+	if sess == nil {
+		return
+	}
+
+	sess.CommitContext(ctx)
+
+	if sess.takeIDPending() {
+		s.updateSessionIDFasthttp(ctx, sess.ID(), s.config.Expires)
+	}
+}
+
+// responseWriter fires the "beforeWrite" once, right before the response's headers are written.
+type responseWriter struct {
+	http.ResponseWriter
+	beforeWrite func()
+	once        sync.Once
+}
+
+func (w *responseWriter) before() {
+	w.once.Do(w.beforeWrite)
+}
+
+func (w *responseWriter) WriteHeader(statusCode int) {
+	w.before()
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.before()
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		w.before()
+		flusher.Flush()
+	}
+}
+
+// Hijack fires the "beforeWrite" and hijacks the connection, i.e. for websockets.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+
+	w.before()
+	return hijacker.Hijack()
+}
+
+// ReadFrom fires the "beforeWrite" and copies the "src" to the original response writer,
+// so its `io.ReaderFrom` implementation, i.e. sendfile, is still used.
+func (w *responseWriter) ReadFrom(src io.Reader) (int64, error) {
+	w.before()
+	return io.Copy(w.ResponseWriter, src)
+}
+
+// Push initiates an HTTP/2 server push, if the original response writer supports it.
+func (w *responseWriter) Push(target string, opts *http.PushOptions) error {
+	if pusher, ok := w.ResponseWriter.(http.Pusher); ok {
+		return pusher.Push(target, opts)
+	}
+
+	return http.ErrNotSupported
+}
+
+// Unwrap returns the original response writer, see `http.ResponseController`.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// WithSession returns a copy of "ctx" which holds the "sess".
+// Use the `FromContext` to retrieve it.
+func WithSession(ctx context.Context, sess *Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, &requestSession{sess: sess})
+}
+
+// FromContext returns the session stored to the "ctx" by the `Handler` and `HandlerFasthttp` middlewares,
+// it returns nil if the "ctx" does not hold any session.
+func FromContext(ctx context.Context) *Session {
+	if rs := getRequestSession(ctx); rs != nil {
+		return rs.get()
+	}
+
+	return nil
+}
+
+// fromContext returns the session of the "ctx",
+// only if it's started by this manager and it's still alive.
+func (s *Sessions) fromContext(ctx context.Context) *Session {
+	sess := FromContext(ctx)
+	if sess == nil || sess.provider != s.provider {
+		return nil
+	}
+
+	if db, ok := sess.db.(*cookieDatabase); ok {
+		if db.isReleased() {
+			return nil
+		}
+
+		return sess
+	}
+
+	if sess.isPending() { // lazy session, not stored yet.
+		return sess
+	}
+
+	s.provider.mu.Lock()
+	alive := s.provider.sessions[sess.ID()] == sess
+	s.provider.mu.Unlock()
+
+	if !alive { // i.e destroyed in the meantime.
+		return nil
+	}
+
+	return sess
+}
+
+// replaceInContext makes the "sess" the session of the "ctx"
+// if the "ctx" is served by a middleware of this manager,
+// i.e. a session started after a `Destroy` of the same request.
+func (s *Sessions) replaceInContext(ctx context.Context, sess *Session) {
+	if rs := getRequestSession(ctx); rs != nil && rs.manager == s {
+		rs.set(sess)
+	}
+}
@@ -0,0 +1,228 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Iterator is an optional interface that a `DatabaseContext` can implement
+// in order to enumerate its stored sessions, see `Sessions.Each`, `Sessions.Count` and `Sessions.Lookup`.
+//
+// When the registered database does not implement it, only the sessions
+// that this instance of the application holds in memory are enumerated.
+type Iterator interface {
+	// IterateContext calls the "cb" for each stored session id, until the "cb" returns false.
+	// The "cb" should not call other methods of the database.
+	IterateContext(ctx context.Context, cb func(sid string) bool) error
+}
+
+// sessionIDs returns the ids of the stored sessions,
+// the entries of the manager itself, i.e. the `NewDatabaseDenylist` ones, are skipped.
+func (p *provider) sessionIDs(ctx context.Context) ([]string, error) {
+	var sids []string
+
+	if iterator, ok := optional[Iterator](p.db); ok {
+		err := iterator.IterateContext(ctx, func(sid string) bool {
+			if !isReservedKey(sid) {
+				sids = append(sids, sid)
+			}
+			return true
+		})
+
+		return sids, err
+	}
+
+	p.mu.Lock()
+	for sid, sess := range p.sessions {
+		if sess.ID() == sid { // skip the new id which is reserved by a regenerate in progress.
+			sids = append(sids, sid)
+		}
+	}
+	p.mu.Unlock()
+
+	return sids, nil
+}
+
+// lookup returns the session of the "sid", if it's alive in memory or stored to the database,
+// it does not create a new session.
+func (p *provider) lookup(ctx context.Context, sid string) *Session {
+	if sid == "" || isReservedKey(sid) {
+		return nil
+	}
+
+	p.mu.Lock()
+	sess, found := p.sessions[sid]
+	p.mu.Unlock()
+
+	if found {
+		if lifetime := sess.lifetime(); lifetime.HasExpired() { // the timer did not run yet.
+			return nil
+		}
+
+		return sess
+	}
+
+	if !p.exists(ctx, sid) {
+		return nil
+	}
+
+	// i.e. it's stored by another instance of the application.
+	return p.detach(ctx, sid)
+}
+
+// detach returns a read-only view of the stored session of the "sid" which is not held in memory.
+// Unlike the `Init` it does not keep the session in memory, it does not start its expiration timer
+// and it does not fire any lifecycle hooks or metrics.
+func (p *provider) detach(ctx context.Context, sid string) *Session {
+	sess := &Session{
+		provider: p,
+		flashes:  make(map[string]*flashMessage),
+		db:       readOnlyDatabase{p.db},
+	}
+	sess.setID(sid)
+
+	stored, _ := p.db.GetContext(ctx, sid, flashesKey)
+	values, _ := stored.(map[string]interface{})
+	for key, value := range values {
+		sess.flashes[key] = &flashMessage{value: value}
+	}
+
+	return sess
+}
+
+// ErrReadOnly is returned by the write methods of a session
+// which is found through the `Sessions.Each` or `Sessions.Lookup`
+// but it's not held in memory by this instance of the application.
+var ErrReadOnly = errors.New("session is read-only")
+
+// readOnlyDatabase is the database of a detached session, see `provider.detach`,
+// the session's values can be read but not changed, the session can still be destroyed.
+type readOnlyDatabase struct {
+	DatabaseContext
+}
+
+func (db readOnlyDatabase) AcquireContext(context.Context, string, time.Duration) (LifeTime, error) {
+	return LifeTime{}, ErrReadOnly
+}
+
+func (db readOnlyDatabase) OnUpdateExpirationContext(context.Context, string, time.Duration) error {
+	return ErrReadOnly
+}
+
+func (db readOnlyDatabase) SetContext(context.Context, string, LifeTime, string, interface{}, bool) error {
+	return ErrReadOnly
+}
+
+func (db readOnlyDatabase) DeleteContext(context.Context, string, string) (bool, error) {
+	return false, ErrReadOnly
+}
+
+func (db readOnlyDatabase) ClearContext(context.Context, string) error {
+	return ErrReadOnly
+}
+
+// Each calls the "cb" for each session known by the manager, until the "cb" returns false.
+// The sessions are enumerated through the registered database if it implements the `Iterator` interface,
+// i.e. all databases of the `sessiondb` folder, so the sessions of all instances of the application are included,
+// otherwise the sessions that this instance holds in memory are enumerated.
+// A session which is not held in memory, i.e. a session of another instance, is a read-only view of it,
+// its write methods return an `ErrReadOnly`.
+// The client-side sessions of the `UseCookieStore` are not known by the server.
+func Each(cb func(sess *Session) bool) error {
+	return Default.Each(cb)
+}
+
+// Each calls the "cb" for each session known by the manager, until the "cb" returns false.
+// The sessions are enumerated through the registered database if it implements the `Iterator` interface,
+// i.e. all databases of the `sessiondb` folder, so the sessions of all instances of the application are included,
+// otherwise the sessions that this instance holds in memory are enumerated.
+// A session which is not held in memory, i.e. a session of another instance, is a read-only view of it,
+// its write methods return an `ErrReadOnly`.
+// The client-side sessions of the `UseCookieStore` are not known by the server.
+func (s *Sessions) Each(cb func(sess *Session) bool) error {
+	return s.EachContext(context.Background(), cb)
+}
+
+// EachContext same as `Each` but it accepts a context,
+// which is passed to the registered database.
+func (s *Sessions) EachContext(ctx context.Context, cb func(sess *Session) bool) error {
+	// collect the ids first, some databases (e.g. boltdb)
+	// can't write while they are still reading.
+	sids, err := s.provider.sessionIDs(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, sid := range sids {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		sess := s.provider.lookup(ctx, sid)
+		if sess == nil { // destroyed or expired in the meantime.
+			continue
+		}
+
+		if !cb(sess) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// Count returns the number of the sessions known by the manager, see `Each`.
+func Count() int {
+	return Default.Count()
+}
+
+// Count returns the number of the sessions known by the manager, see `Each`.
+func (s *Sessions) Count() int {
+	n, _ := s.CountContext(context.Background())
+	return n
+}
+
+// CountContext same as `Count` but it accepts a context
+// and it returns any error coming from the registered database.
+func (s *Sessions) CountContext(ctx context.Context) (int, error) {
+	sids, err := s.provider.sessionIDs(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, sid := range sids {
+		if err = ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		if s.provider.isAlive(ctx, sid) { // i.e. not expired but not purged yet.
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// Lookup returns the session of the "sid" if it's known by the manager, otherwise nil,
+// unlike the `Start` it does not create a new session and it does not touch its expiration.
+// A session which is not held in memory is a read-only view of it, see `Each`.
+// The client-side sessions of the `UseCookieStore` are not known by the server.
+func Lookup(sid string) *Session {
+	return Default.Lookup(sid)
+}
+
+// Lookup returns the session of the "sid" if it's known by the manager, otherwise nil,
+// unlike the `Start` it does not create a new session and it does not touch its expiration.
+// A session which is not held in memory is a read-only view of it, see `Each`.
+// The client-side sessions of the `UseCookieStore` are not known by the server.
+func (s *Sessions) Lookup(sid string) *Session {
+	return s.LookupContext(context.Background(), sid)
+}
+
+// LookupContext same as `Lookup` but it accepts a context,
+// which is passed to the registered database.
+func (s *Sessions) LookupContext(ctx context.Context, sid string) *Session {
+	return s.provider.lookup(ctx, sid)
+}
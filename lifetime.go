@@ -13,12 +13,15 @@ type LifeTime struct {
 	// (this should be a bug(go1.9-rc1) or not. We don't care atm)
 	time.Time
 	timer *time.Timer
+	// absolute is the hard expiration limit that no shift can extend,
+	// see `Config.AbsoluteTimeout`.
+	absolute time.Time
 }
 
 // Begin will begin the life based on the time.Now().Add(d).
 // Use `Continue` to continue from a stored time(database-based session does that).
 func (lt *LifeTime) Begin(d time.Duration, onExpire func()) {
-	if d <= 0 {
+	if d = lt.limit(d); d <= 0 {
 		return
 	}
 
@@ -29,6 +32,10 @@ func (lt *LifeTime) Begin(d time.Duration, onExpire func()) {
 // Revive will continue the life based on the stored Time.
 // Other words that could be used for this func are: Continue, Restore, Resc.
 func (lt *LifeTime) Revive(onExpire func()) {
+	if !lt.absolute.IsZero() && (lt.Time.IsZero() || lt.Time.After(lt.absolute)) {
+		lt.Time = lt.absolute
+	}
+
 	if lt.Time.IsZero() {
 		return
 	}
@@ -40,13 +47,42 @@ func (lt *LifeTime) Revive(onExpire func()) {
 	}
 }
 
-// Shift resets the lifetime based on "d".
+// Shift resets the lifetime based on "d",
+// it never exceeds the absolute expiration, if any.
 func (lt *LifeTime) Shift(d time.Duration) {
-	if d > 0 && lt.timer != nil {
+	if d = lt.limit(d); d <= 0 {
+		return
+	}
+
+	lt.Time = time.Now().Add(d)
+	if lt.timer != nil {
 		lt.timer.Reset(d)
 	}
 }
 
+// limit returns the "d" limited by the absolute expiration, if any.
+// A "d" <= 0 means no expiration, so the remaining time until the absolute expiration is returned instead,
+// which can be negative if it has passed.
+func (lt *LifeTime) limit(d time.Duration) time.Duration {
+	if lt.absolute.IsZero() {
+		return d
+	}
+
+	if remaining := time.Until(lt.absolute); d <= 0 || d > remaining {
+		return remaining
+	}
+
+	return d
+}
+
+// stop stops the expiration timer, if any, without touching the stored time.
+func (lt *LifeTime) stop() {
+	if lt.timer != nil {
+		lt.timer.Stop()
+		lt.timer = nil
+	}
+}
+
 // ExpireNow reduce the lifetime completely.
 func (lt *LifeTime) ExpireNow() {
 	lt.Time = CookieExpireDelete
@@ -57,6 +93,10 @@ func (lt *LifeTime) ExpireNow() {
 
 // HasExpired reports whether "lt" represents is expired.
 func (lt *LifeTime) HasExpired() bool {
+	if !lt.absolute.IsZero() && lt.absolute.Before(time.Now()) {
+		return true
+	}
+
 	if lt.IsZero() {
 		return false
 	}
@@ -0,0 +1,226 @@
+package sessions
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// ErrNotLocked is returned by the `Session.Unlock` when the session is not locked by the `Session.Lock`
+// or its lock has been released in the meantime because its lease has expired, see `Config.LockLease`.
+// It's returned by the `Locker` databases too, when the lock is not held by the given token.
+var ErrNotLocked = errors.New("session is not locked")
+
+// Locker is an optional interface that a `DatabaseContext` can implement
+// in order to lock a session across the processes of the application, see `Session.Lock`.
+//
+// A database which does not implement it locks the sessions in-process only.
+type Locker interface {
+	// LockContext acquires the lock of the session "sid", it blocks until the lock is acquired or the "ctx" is done.
+	// The lock is released automatically after the "lease", so a terminated process does not hold it forever.
+	//
+	// It returns the fencing token of the lock, a number that increases on each acquisition,
+	// so a storage can reject the writes of a holder which its lease has expired.
+	LockContext(ctx context.Context, sid string, lease time.Duration) (token uint64, err error)
+	// UnlockContext releases the lock of the session "sid" if it's still held by the "token",
+	// otherwise it returns the `ErrNotLocked`.
+	UnlockContext(ctx context.Context, sid string, token uint64) error
+}
+
+// localLocker is the in-process `Locker`,
+// it's used when the registered database does not implement the `Locker` interface.
+type localLocker struct {
+	mu    sync.Mutex
+	locks map[string]*localLock
+	fence uint64
+}
+
+type localLock struct {
+	token    uint64
+	timer    *time.Timer
+	released chan struct{}
+}
+
+var _ Locker = (*localLocker)(nil)
+
+func (l *localLocker) LockContext(ctx context.Context, sid string, lease time.Duration) (uint64, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		l.mu.Lock()
+		held, ok := l.locks[sid]
+		if !ok {
+			if l.locks == nil {
+				l.locks = make(map[string]*localLock)
+			}
+
+			l.fence++
+			token := l.fence
+			lock := &localLock{token: token, released: make(chan struct{})}
+			lock.timer = time.AfterFunc(lease, func() {
+				l.UnlockContext(context.Background(), sid, token)
+			})
+			l.locks[sid] = lock
+			l.mu.Unlock()
+
+			return token, nil
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-held.released:
+		}
+	}
+}
+
+func (l *localLocker) UnlockContext(_ context.Context, sid string, token uint64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lock, ok := l.locks[sid]
+	if !ok || lock.token != token {
+		return ErrNotLocked
+	}
+
+	lock.timer.Stop()
+	delete(l.locks, sid)
+	close(lock.released)
+	return nil
+}
+
+// locker returns the `Locker` of the registered database, or the in-process one.
+func (p *provider) locker() Locker {
+	if locker, ok := optional[Locker](p.db); ok {
+		return locker
+	}
+
+	return &p.localLocks
+}
+
+// SessionLock is the lock of a session acquired by the `Session.Lock`.
+// It's owned by its caller, so concurrent holders of the same session,
+// i.e. a holder which its lease has expired and the next one, never release each other's lock.
+type SessionLock struct {
+	provider *provider
+	sid      string
+	token    uint64
+}
+
+// Lock acquires the exclusive lock of the session, it blocks until the lock is acquired or the "ctx" is done,
+// so concurrent requests of the same session, i.e. AJAX requests of a browser, do not race on its values.
+// The lock is held across the processes of the application by the databases which implement
+// the `Locker` interface, i.e. redis, otherwise it is held in-process.
+//
+// The lock is released by the returned lock's `Unlock` or when its lease has expired, see `Config.LockLease`.
+// See the `LockHandler` and `LockHandlerFasthttp` middlewares too.
+func (s *Session) Lock(ctx context.Context) (*SessionLock, error) {
+	sid := s.ID()
+	token, err := s.provider.locker().LockContext(ctx, sid, s.provider.config.LockLease)
+	if err != nil {
+		return nil, err
+	}
+
+	if s.buffer != nil { // the values may be changed by the previous holder.
+		s.buffer.reset()
+	}
+
+	return &SessionLock{provider: s.provider, sid: sid, token: token}, nil
+}
+
+// Unlock releases the lock.
+// It returns the `ErrNotLocked` if the lock is already released
+// or its lease has expired in the meantime.
+func (l *SessionLock) Unlock() error {
+	return l.UnlockContext(context.Background())
+}
+
+// UnlockContext same as `Unlock` but it accepts a context,
+// which is passed to the registered database.
+func (l *SessionLock) UnlockContext(ctx context.Context) error {
+	return l.provider.locker().UnlockContext(ctx, l.sid, l.token)
+}
+
+// Token returns the fencing token of the lock.
+// The token increases on each acquisition of the lock, pass it to a storage which should reject
+// the writes of a previous holder, i.e. a holder which its lease has expired while it was paused.
+func (l *SessionLock) Token() uint64 {
+	return l.token
+}
+
+// LockHandler returns a net/http middleware which serializes the requests of the same session,
+// it holds the lock of the session, see `Session.Lock`, while the "next" handler is running.
+// It responds with 503 Service Unavailable if the lock can not be acquired,
+// i.e. the request has been canceled while waiting.
+//
+// It can be registered under the `Handler` middleware or on its own.
+func LockHandler(next http.Handler) http.Handler {
+	return Default.LockHandler(next)
+}
+
+// LockHandler returns a net/http middleware which serializes the requests of the same session,
+// it holds the lock of the session, see `Session.Lock`, while the "next" handler is running.
+// It responds with 503 Service Unavailable if the lock can not be acquired,
+// i.e. the request has been canceled while waiting.
+//
+// It can be registered under the `Handler` middleware or on its own.
+func (s *Sessions) LockHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess := s.Start(w, r)
+		lock, err := sess.Lock(r.Context())
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+
+		defer func() {
+			// the buffered changes are written while the lock is still held.
+			sess.CommitContext(r.Context())
+			lock.Unlock()
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// LockHandlerFasthttp returns a valyala/fasthttp middleware which serializes the requests of the same session,
+// it holds the lock of the session, see `Session.Lock`, while the "next" handler is running.
+// It responds with 503 Service Unavailable if the lock can not be acquired,
+// i.e. the request has been canceled while waiting.
+//
+// It can be registered under the `HandlerFasthttp` middleware or on its own.
+func LockHandlerFasthttp(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return Default.LockHandlerFasthttp(next)
+}
+
+// LockHandlerFasthttp returns a valyala/fasthttp middleware which serializes the requests of the same session,
+// it holds the lock of the session, see `Session.Lock`, while the "next" handler is running.
+// It responds with 503 Service Unavailable if the lock can not be acquired,
+// i.e. the request has been canceled while waiting.
+//
+// It can be registered under the `HandlerFasthttp` middleware or on its own.
+func (s *Sessions) LockHandlerFasthttp(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		sess := s.StartFasthttp(ctx)
+		lock, err := sess.Lock(ctx)
+		if err != nil {
+			ctx.Error(fasthttp.StatusMessage(fasthttp.StatusServiceUnavailable), fasthttp.StatusServiceUnavailable)
+			return
+		}
+
+		defer func() {
+			// the buffered changes are written while the lock is still held.
+			sess.CommitContext(ctx)
+			lock.Unlock()
+		}()
+
+		next(ctx)
+	}
+}
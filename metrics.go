@@ -0,0 +1,332 @@
+package sessions
+
+import (
+	"context"
+	"expvar"
+	"sync"
+	"time"
+)
+
+// Metrics receives the measurements of a sessions manager, see `Sessions.UseMetrics`.
+//
+// The `ExpvarMetrics` is the builtin, zero-dependency, implementation.
+// The methods map to the Prometheus collectors one by one,
+// i.e. counters for the sessions, a counter vector by reason for the destroyed ones
+// and a histogram vector by method for the database calls,
+// register a gauge func of the `Sessions.Count` for the number of the sessions.
+type Metrics interface {
+	// SessionCreated is called when a new session is created.
+	SessionCreated()
+	// SessionLoaded is called when an existing session, which is not in memory,
+	// is read back from the registered database, i.e. after a restart.
+	SessionLoaded()
+	// SessionRead is called when a request reads an existing session which is in memory.
+	SessionRead()
+	// SessionDestroyed is called when a session is destroyed,
+	// the "reason" tells an expiration from a logout, see `DestroyReason`.
+	SessionDestroyed(reason DestroyReason)
+	// DatabaseCall is called after each call to the registered database,
+	// the "method" is the name of the database's method, i.e. "GetContext".
+	// An `ErrNotFound` is not reported as an error.
+	DatabaseCall(method string, elapsed time.Duration, err error)
+}
+
+// noMetrics is the `Metrics` of a manager without the `UseMetrics`.
+type noMetrics struct{}
+
+func (noMetrics) SessionCreated()                           {}
+func (noMetrics) SessionLoaded()                            {}
+func (noMetrics) SessionRead()                              {}
+func (noMetrics) SessionDestroyed(DestroyReason)            {}
+func (noMetrics) DatabaseCall(string, time.Duration, error) {}
+
+// UseMetrics registers the "metrics" of the manager, see `NewExpvarMetrics`.
+// The calls to the registered database are measured as well, register it before or after.
+// It should be called before the first `Start`, like the `UseDatabase`, it panics otherwise.
+func UseMetrics(metrics Metrics) {
+	Default.UseMetrics(metrics)
+}
+
+// UseMetrics registers the "metrics" of the manager, see `NewExpvarMetrics`.
+// The calls to the registered database are measured as well, register it before or after.
+// It should be called before the first `Start`, like the `UseDatabase`, it panics otherwise.
+func (s *Sessions) UseMetrics(metrics Metrics) {
+	if s.provider.started.Load() {
+		// the metrics and the registered database are read by the requests without a lock.
+		panic("sessions: UseMetrics should be called before the first Start")
+	}
+
+	if metrics == nil {
+		metrics = noMetrics{}
+	}
+
+	if m, ok := metrics.(*ExpvarMetrics); ok {
+		m.addActive(s.provider.activeCount)
+	}
+
+	p := s.provider
+	p.mu.Lock()
+	p.metrics = metrics
+	p.db = p.measure(unwrapDatabase(p.db))
+	p.mu.Unlock()
+}
+
+// activeCount returns the number of the sessions in memory.
+func (p *provider) activeCount() int {
+	p.mu.Lock()
+	n := len(p.sessions)
+	p.mu.Unlock()
+	return n
+}
+
+// measure wraps the "db" in order to measure its calls, if the `UseMetrics` is used.
+func (p *provider) measure(db DatabaseContext) DatabaseContext {
+	if _, disabled := p.metrics.(noMetrics); disabled {
+		return db
+	}
+
+	return &metricsDatabase{db: db, metrics: p.metrics}
+}
+
+// ExpvarMetrics is the default `Metrics`, it publishes the measurements through the standard expvar package,
+// i.e. under the /debug/vars endpoint of the http.DefaultServeMux, as a map of:
+//
+//	active: the number of the sessions in memory
+//	created, loaded, read: the number of the sessions created, loaded back from the database and read
+//	destroyed: the number of the destroyed sessions by reason, i.e. "expired" or "destroy"
+//	db_calls, db_errors, db_nanoseconds: the number, the errors and the total duration of the database calls by method
+type ExpvarMetrics struct {
+	vars          *expvar.Map
+	destroyed     *expvar.Map
+	dbCalls       *expvar.Map
+	dbErrors      *expvar.Map
+	dbNanoseconds *expvar.Map
+
+	mu     sync.Mutex
+	active []func() int // of each manager which uses these metrics.
+}
+
+var _ Metrics = (*ExpvarMetrics)(nil)
+
+var (
+	expvarMetricsMu sync.Mutex
+	expvarMetrics   = make(map[string]*ExpvarMetrics)
+)
+
+// NewExpvarMetrics returns a new `ExpvarMetrics` which is published under the "name".
+// The same "name" returns the same metrics, so they can be shared by several managers,
+// i.e. on tests, and their "active" is the sum of their sessions in memory.
+// It panics if the "name" is already published by another package, like the expvar.Publish.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	expvarMetricsMu.Lock()
+	defer expvarMetricsMu.Unlock()
+
+	if m, ok := expvarMetrics[name]; ok {
+		return m
+	}
+
+	m := &ExpvarMetrics{
+		vars:          expvar.NewMap(name),
+		destroyed:     new(expvar.Map).Init(),
+		dbCalls:       new(expvar.Map).Init(),
+		dbErrors:      new(expvar.Map).Init(),
+		dbNanoseconds: new(expvar.Map).Init(),
+	}
+
+	m.vars.Set("active", expvar.Func(func() interface{} {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		n := 0
+		for _, count := range m.active {
+			n += count()
+		}
+
+		return n
+	}))
+	m.vars.Set("destroyed", m.destroyed)
+	m.vars.Set("db_calls", m.dbCalls)
+	m.vars.Set("db_errors", m.dbErrors)
+	m.vars.Set("db_nanoseconds", m.dbNanoseconds)
+
+	expvarMetrics[name] = m
+	return m
+}
+
+func (m *ExpvarMetrics) addActive(count func() int) {
+	m.mu.Lock()
+	m.active = append(m.active, count)
+	m.mu.Unlock()
+}
+
+// SessionCreated increments the "created" counter.
+func (m *ExpvarMetrics) SessionCreated() {
+	m.vars.Add("created", 1)
+}
+
+// SessionLoaded increments the "loaded" counter.
+func (m *ExpvarMetrics) SessionLoaded() {
+	m.vars.Add("loaded", 1)
+}
+
+// SessionRead increments the "read" counter.
+func (m *ExpvarMetrics) SessionRead() {
+	m.vars.Add("read", 1)
+}
+
+// SessionDestroyed increments the "destroyed" counter of the "reason".
+func (m *ExpvarMetrics) SessionDestroyed(reason DestroyReason) {
+	m.destroyed.Add(reason.String(), 1)
+}
+
+// DatabaseCall increments the "db_calls", the "db_errors" and the "db_nanoseconds" counters of the "method".
+func (m *ExpvarMetrics) DatabaseCall(method string, elapsed time.Duration, err error) {
+	m.dbCalls.Add(method, 1)
+	m.dbNanoseconds.Add(method, int64(elapsed))
+	if err != nil {
+		m.dbErrors.Add(method, 1)
+	}
+}
+
+// metricsDatabase is the `DatabaseContext` which measures the calls to the registered database.
+// It implements all the optional interfaces, i.e. the `Exister`,
+// use the `optional` to check them against the registered database.
+type metricsDatabase struct {
+	db      DatabaseContext
+	metrics Metrics
+}
+
+var (
+	_ DatabaseContext = (*metricsDatabase)(nil)
+	_ Exister         = (*metricsDatabase)(nil)
+	_ Transactional   = (*metricsDatabase)(nil)
+	_ Locker          = (*metricsDatabase)(nil)
+	_ Iterator        = (*metricsDatabase)(nil)
+)
+
+// unwrapDatabase returns the registered database of a measured "db".
+func unwrapDatabase(db DatabaseContext) DatabaseContext {
+	if m, ok := db.(*metricsDatabase); ok {
+		return m.db
+	}
+
+	return db
+}
+
+// optional returns the "db" as the optional interface T, i.e. the `Exister`,
+// only if the registered database implements it.
+func optional[T any](db DatabaseContext) (T, bool) {
+	if _, ok := unwrapDatabase(db).(T); !ok {
+		var zero T
+		return zero, false
+	}
+
+	v, ok := db.(T)
+	return v, ok
+}
+
+func (m *metricsDatabase) observe(method string, start time.Time, err error) {
+	if err == ErrNotFound {
+		err = nil
+	}
+
+	m.metrics.DatabaseCall(method, time.Since(start), err)
+}
+
+func (m *metricsDatabase) AcquireContext(ctx context.Context, sid string, expires time.Duration) (LifeTime, error) {
+	start := time.Now()
+	lifetime, err := m.db.AcquireContext(ctx, sid, expires)
+	m.observe("AcquireContext", start, err)
+	return lifetime, err
+}
+
+func (m *metricsDatabase) OnUpdateExpirationContext(ctx context.Context, sid string, newExpires time.Duration) error {
+	start := time.Now()
+	err := m.db.OnUpdateExpirationContext(ctx, sid, newExpires)
+	m.observe("OnUpdateExpirationContext", start, err)
+	return err
+}
+
+func (m *metricsDatabase) SetContext(ctx context.Context, sid string, lifetime LifeTime, key string, value interface{}, immutable bool) error {
+	start := time.Now()
+	err := m.db.SetContext(ctx, sid, lifetime, key, value, immutable)
+	m.observe("SetContext", start, err)
+	return err
+}
+
+func (m *metricsDatabase) GetContext(ctx context.Context, sid string, key string) (interface{}, error) {
+	start := time.Now()
+	v, err := m.db.GetContext(ctx, sid, key)
+	m.observe("GetContext", start, err)
+	return v, err
+}
+
+func (m *metricsDatabase) VisitContext(ctx context.Context, sid string, cb func(key string, value interface{})) error {
+	start := time.Now()
+	err := m.db.VisitContext(ctx, sid, cb)
+	m.observe("VisitContext", start, err)
+	return err
+}
+
+func (m *metricsDatabase) LenContext(ctx context.Context, sid string) (int, error) {
+	start := time.Now()
+	n, err := m.db.LenContext(ctx, sid)
+	m.observe("LenContext", start, err)
+	return n, err
+}
+
+func (m *metricsDatabase) DeleteContext(ctx context.Context, sid string, key string) (bool, error) {
+	start := time.Now()
+	deleted, err := m.db.DeleteContext(ctx, sid, key)
+	m.observe("DeleteContext", start, err)
+	return deleted, err
+}
+
+func (m *metricsDatabase) ClearContext(ctx context.Context, sid string) error {
+	start := time.Now()
+	err := m.db.ClearContext(ctx, sid)
+	m.observe("ClearContext", start, err)
+	return err
+}
+
+func (m *metricsDatabase) ReleaseContext(ctx context.Context, sid string) error {
+	start := time.Now()
+	err := m.db.ReleaseContext(ctx, sid)
+	m.observe("ReleaseContext", start, err)
+	return err
+}
+
+func (m *metricsDatabase) Exists(ctx context.Context, sid string) (bool, error) {
+	start := time.Now()
+	exists, err := m.db.(Exister).Exists(ctx, sid)
+	m.observe("Exists", start, err)
+	return exists, err
+}
+
+func (m *metricsDatabase) UpdateContext(ctx context.Context, sid string, lifetime LifeTime, fn func(tx Tx) error) error {
+	start := time.Now()
+	err := m.db.(Transactional).UpdateContext(ctx, sid, lifetime, fn)
+	m.observe("UpdateContext", start, err)
+	return err
+}
+
+func (m *metricsDatabase) LockContext(ctx context.Context, sid string, lease time.Duration) (uint64, error) {
+	start := time.Now()
+	token, err := m.db.(Locker).LockContext(ctx, sid, lease)
+	m.observe("LockContext", start, err)
+	return token, err
+}
+
+func (m *metricsDatabase) UnlockContext(ctx context.Context, sid string, token uint64) error {
+	start := time.Now()
+	err := m.db.(Locker).UnlockContext(ctx, sid, token)
+	m.observe("UnlockContext", start, err)
+	return err
+}
+
+func (m *metricsDatabase) IterateContext(ctx context.Context, cb func(sid string) bool) error {
+	start := time.Now()
+	err := m.db.(Iterator).IterateContext(ctx, cb)
+	m.observe("IterateContext", start, err)
+	return err
+}
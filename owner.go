@@ -0,0 +1,389 @@
+package sessions
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ownerKey is the reserved key of the session's owner, see `Session.SetOwner`.
+const ownerKey = reservedKeyPrefix + "owner"
+
+// ownerIndexPrefix is the prefix of the database entries which index the sessions of an owner.
+// Each owner's index is stored as a database session which its keys are the ids of the owner's sessions.
+const ownerIndexPrefix = reservedKeyPrefix + "owner_"
+
+// ownerIndexID returns the id of the index entry of the "ownerID",
+// the owner id is hex-encoded, so it does not contain any delimiter of the databases.
+func ownerIndexID(ownerID string) string {
+	return ownerIndexPrefix + hex.EncodeToString([]byte(ownerID))
+}
+
+// ownerOf returns the owner of the session "sid" stored to the "db", if any.
+func ownerOf(ctx context.Context, db DatabaseContext, sid string) string {
+	v, err := db.GetContext(ctx, sid, ownerKey)
+	if err != nil {
+		return ""
+	}
+
+	owner, _ := v.(string)
+	return owner
+}
+
+// OwnerLimitPolicy decides how a new session of an owner is handled
+// when the owner has reached the `Config.MaxSessionsPerOwner` limit.
+type OwnerLimitPolicy uint8
+
+const (
+	// OwnerLimitReject rejects the new session, the `Session.SetOwnerE` returns the `ErrOwnerLimit`.
+	OwnerLimitReject OwnerLimitPolicy = iota
+	// OwnerLimitEvictOldest destroys the session of the owner which was bound to it first.
+	OwnerLimitEvictOldest
+	// OwnerLimitEvictLRU destroys the session of the owner which was least recently used.
+	// The use of a session is recorded to its owner's index on each `Start` of it.
+	OwnerLimitEvictLRU
+)
+
+// ErrOwnerLimit is returned by the `Session.SetOwnerE` when the owner has reached
+// the `Config.MaxSessionsPerOwner` limit and the `Config.OwnerLimitPolicy` is the `OwnerLimitReject`.
+var ErrOwnerLimit = errors.New("owner has reached the maximum number of sessions")
+
+// ownerEntry is an entry of an owner's index, a session id with the time
+// that the session was bound to the owner and the time of its last use.
+type ownerEntry struct {
+	sid   string
+	since time.Time
+	used  time.Time
+}
+
+func newOwnerEntry(sid string) ownerEntry {
+	now := time.Now()
+	return ownerEntry{sid: sid, since: now, used: now}
+}
+
+// value returns the stored value of the entry,
+// as string, so any database encoder can keep it as it's.
+func (e ownerEntry) value() string {
+	return strconv.FormatInt(e.since.UnixNano(), 10) + ":" + strconv.FormatInt(e.used.UnixNano(), 10)
+}
+
+// parseOwnerEntry parses a stored entry, see `value`.
+func parseOwnerEntry(sid string, v interface{}) ownerEntry {
+	e := ownerEntry{sid: sid}
+
+	str, _ := v.(string)
+	since, used, _ := strings.Cut(str, ":")
+	if n, err := strconv.ParseInt(since, 10, 64); err == nil {
+		e.since = time.Unix(0, n)
+	}
+	if n, err := strconv.ParseInt(used, 10, 64); err == nil {
+		e.used = time.Unix(0, n)
+	}
+
+	return e
+}
+
+// indexOwner adds the "entry" to the index of the "ownerID".
+func (p *provider) indexOwner(ctx context.Context, ownerID string, entry ownerEntry) error {
+	indexID := ownerIndexID(ownerID)
+
+	p.ownersMu.Lock()
+	defer p.ownersMu.Unlock()
+
+	if !p.exists(ctx, indexID) {
+		// it does not expire, its entries are removed when the sessions are destroyed
+		// and the expired ones are removed by the `SessionsOf`.
+		if _, err := p.db.AcquireContext(ctx, indexID, 0); err != nil {
+			return err
+		}
+	}
+
+	return p.db.SetContext(ctx, indexID, LifeTime{}, entry.sid, entry.value(), false)
+}
+
+// reindexOwner moves the entry of the "oldSid" to the "newSid" in the index of the "ownerID",
+// i.e. on `Regenerate`.
+func (p *provider) reindexOwner(ctx context.Context, ownerID, oldSid, newSid string) error {
+	indexID := ownerIndexID(ownerID)
+
+	p.ownersMu.Lock()
+	v, err := p.db.GetContext(ctx, indexID, oldSid)
+	if err == nil {
+		p.db.DeleteContext(ctx, indexID, oldSid)
+	}
+	p.ownersMu.Unlock()
+
+	entry := newOwnerEntry(newSid)
+	if err == nil {
+		entry = parseOwnerEntry(newSid, v)
+	}
+
+	return p.indexOwner(ctx, ownerID, entry)
+}
+
+// unindexOwner removes the session "sid" from the index of the "ownerID", if any.
+func (p *provider) unindexOwner(ctx context.Context, ownerID, sid string) error {
+	if ownerID == "" {
+		return nil
+	}
+
+	p.ownersMu.Lock()
+	_, err := p.db.DeleteContext(ctx, ownerIndexID(ownerID), sid)
+	p.ownersMu.Unlock()
+
+	if err == ErrNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// touchOwner records the use of the "sess" to its owner's index, for the `OwnerLimitEvictLRU`.
+func (p *provider) touchOwner(ctx context.Context, sess *Session) {
+	if p.config.MaxSessionsPerOwner <= 0 || p.config.OwnerLimitPolicy != OwnerLimitEvictLRU || sess.isPending() {
+		return
+	}
+
+	owner := ownerOf(ctx, sess.database(), sess.ID())
+	if owner == "" {
+		return
+	}
+
+	indexID := ownerIndexID(owner)
+
+	p.ownersMu.Lock()
+	defer p.ownersMu.Unlock()
+
+	v, err := p.db.GetContext(ctx, indexID, sess.ID())
+	if err != nil { // removed from the index in the meantime.
+		return
+	}
+
+	entry := parseOwnerEntry(sess.ID(), v)
+	entry.used = time.Now()
+	p.db.SetContext(ctx, indexID, LifeTime{}, entry.sid, entry.value(), false)
+}
+
+// isAlive reports whether the session "sid" is alive in memory or stored to the database,
+// unlike the `lookup` it does not load the session.
+func (p *provider) isAlive(ctx context.Context, sid string) bool {
+	p.mu.Lock()
+	sess, found := p.sessions[sid]
+	p.mu.Unlock()
+
+	if found {
+		lifetime := sess.lifetime()
+		return !lifetime.HasExpired()
+	}
+
+	return p.exists(ctx, sid)
+}
+
+// ownerEntries returns the entries of the index of the "ownerID".
+// If "alive" is not nil, the entries of the sessions which are not alive,
+// i.e. expired, are removed from the index and they are not returned.
+func (p *provider) ownerEntries(ctx context.Context, ownerID string, alive func(ctx context.Context, sid string) bool) ([]ownerEntry, error) {
+	var entries []ownerEntry
+	err := p.db.VisitContext(ctx, ownerIndexID(ownerID), func(sid string, v interface{}) {
+		entries = append(entries, parseOwnerEntry(sid, v))
+	})
+
+	if err == ErrNotFound {
+		return nil, nil
+	}
+
+	if err != nil || alive == nil {
+		return entries, err
+	}
+
+	n := 0
+	for _, entry := range entries {
+		if !alive(ctx, entry.sid) {
+			p.unindexOwner(ctx, ownerID, entry.sid)
+			continue
+		}
+
+		entries[n] = entry
+		n++
+	}
+
+	return entries[:n], nil
+}
+
+// limitOwner makes room for a new session of the "ownerID",
+// based on the `Config.MaxSessionsPerOwner` and the `Config.OwnerLimitPolicy`.
+func (p *provider) limitOwner(ctx context.Context, ownerID string) error {
+	limit := p.config.MaxSessionsPerOwner
+	if limit <= 0 {
+		return nil
+	}
+
+	entries, err := p.ownerEntries(ctx, ownerID, p.isAlive)
+	if err != nil {
+		return err
+	}
+
+	n := len(entries) - limit + 1
+	if n <= 0 {
+		return nil
+	}
+
+	switch p.config.OwnerLimitPolicy {
+	case OwnerLimitEvictOldest:
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].since.Before(entries[j].since)
+		})
+	case OwnerLimitEvictLRU:
+		sort.Slice(entries, func(i, j int) bool {
+			return entries[i].used.Before(entries[j].used)
+		})
+	default:
+		return ErrOwnerLimit
+	}
+
+	for _, entry := range entries[:n] {
+		p.Destroy(entry.sid, ReasonEvicted)
+	}
+
+	return nil
+}
+
+// SetOwner binds the session to the "ownerID", i.e. the id of the logged-in user,
+// so all the sessions of the same owner can be found and destroyed at once,
+// see the `Sessions.SessionsOf` and `Sessions.DestroyOwner` methods.
+// The owner's index is stored to the registered database, so it's shared between instances.
+// An empty "ownerID" unbinds the session from its owner.
+func (s *Session) SetOwner(ownerID string) {
+	s.SetOwnerE(context.Background(), ownerID)
+}
+
+// SetOwnerE same as `SetOwner` but it returns any error coming from the registered database,
+// or the `ErrOwnerLimit` when the owner has reached the `Config.MaxSessionsPerOwner` limit.
+func (s *Session) SetOwnerE(ctx context.Context, ownerID string) error {
+	s.persist(ctx)
+
+	previous := ownerOf(ctx, s.database(), s.ID())
+	if previous == ownerID {
+		return nil
+	}
+
+	if ownerID != "" && s.provider.config.MaxSessionsPerOwner > 0 {
+		// the count, the eviction and the insertion of the owner's sessions are one unit,
+		// under the lock of the owner's index, which is held across the processes by the `Locker` databases.
+		locker, indexID := s.provider.locker(), ownerIndexID(ownerID)
+		token, err := locker.LockContext(ctx, indexID, s.provider.config.LockLease)
+		if err != nil {
+			return err
+		}
+		defer locker.UnlockContext(ctx, indexID, token)
+
+		if err = s.provider.limitOwner(ctx, ownerID); err != nil {
+			return err
+		}
+	}
+
+	if err := s.provider.unindexOwner(ctx, previous, s.ID()); err != nil {
+		return err
+	}
+
+	if ownerID == "" {
+		_, err := s.database().DeleteContext(ctx, s.ID(), ownerKey)
+		return err
+	}
+
+	if err := s.provider.indexOwner(ctx, ownerID, newOwnerEntry(s.ID())); err != nil {
+		return err
+	}
+
+	return s.database().SetContext(ctx, s.ID(), s.lifetime(), ownerKey, ownerID, false)
+}
+
+// Owner returns the owner of the session, see `SetOwner`, or empty if it's not bound to an owner.
+func (s *Session) Owner() string {
+	return ownerOf(context.Background(), s.database(), s.ID())
+}
+
+// SessionsOf returns the ids of the alive sessions of the "ownerID", see `Session.SetOwner`.
+// Use the `Lookup` to retrieve a session by its id.
+func SessionsOf(ownerID string) []string {
+	return Default.SessionsOf(ownerID)
+}
+
+// SessionsOf returns the ids of the alive sessions of the "ownerID", see `Session.SetOwner`.
+// Use the `Lookup` to retrieve a session by its id.
+func (s *Sessions) SessionsOf(ownerID string) []string {
+	sids, _ := s.SessionsOfContext(context.Background(), ownerID)
+	return sids
+}
+
+// SessionsOfContext same as `SessionsOf` but it accepts a context
+// and it returns any error coming from the registered database.
+func (s *Sessions) SessionsOfContext(ctx context.Context, ownerID string) ([]string, error) {
+	alive := s.provider.isAlive
+	if s.cookies != nil {
+		alive = func(ctx context.Context, sid string) bool {
+			return !s.cookies.isRevoked(ctx, sid)
+		}
+	}
+
+	entries, err := s.provider.ownerEntries(ctx, ownerID, alive)
+	if err != nil {
+		return nil, err
+	}
+
+	sids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		sids = append(sids, entry.sid)
+	}
+
+	return sids, nil
+}
+
+// DestroyOwner destroys all the sessions of the "ownerID", see `Session.SetOwner`,
+// i.e. to log out a user everywhere after a password reset.
+// The sessions of all instances of the application are destroyed,
+// the other instances stop serving them from their memory on `Config.VerifyExists`,
+// a client-side session, see `UseCookieStore`, is revoked.
+func DestroyOwner(ownerID string) {
+	Default.DestroyOwner(ownerID)
+}
+
+// DestroyOwner destroys all the sessions of the "ownerID", see `Session.SetOwner`,
+// i.e. to log out a user everywhere after a password reset.
+// The sessions of all instances of the application are destroyed,
+// the other instances stop serving them from their memory on `Config.VerifyExists`,
+// a client-side session, see `UseCookieStore`, is revoked.
+func (s *Sessions) DestroyOwner(ownerID string) {
+	s.DestroyOwnerContext(context.Background(), ownerID)
+}
+
+// DestroyOwnerContext same as `DestroyOwner` but it accepts a context
+// and it returns any error coming from the registered database.
+func (s *Sessions) DestroyOwnerContext(ctx context.Context, ownerID string) error {
+	entries, err := s.provider.ownerEntries(ctx, ownerID, nil)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if s.cookies != nil {
+			if err = s.cookies.revoke(ctx, entry.sid, time.Time{}); err != nil {
+				return err
+			}
+
+			s.provider.fireDestroy(DestroyEvent{ID: entry.sid, Reason: ReasonDestroyOwner})
+			continue
+		}
+
+		s.provider.Destroy(entry.sid, ReasonDestroyOwner)
+	}
+
+	s.provider.ownersMu.Lock()
+	err = s.provider.db.ReleaseContext(ctx, ownerIndexID(ownerID))
+	s.provider.ownersMu.Unlock()
+	return err
+}
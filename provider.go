@@ -1,8 +1,10 @@
 package sessions
 
 import (
+	"context"
 	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -13,35 +15,109 @@ type (
 		// we don't use RWMutex because all actions have read and write at the same action function.
 		// (or write to a *Session's value which is race if we don't lock)
 		// narrow locks are fasters but are useless here.
-		mu               sync.Mutex
-		sessions         map[string]*Session
-		db               Database
-		destroyListeners []DestroyListener
+		mu                    sync.Mutex
+		config                *Config
+		sessions              map[string]*Session
+		db                    DatabaseContext
+		destroyListeners      []DestroyListener
+		destroyEventListeners []DestroyEventListener
+		hooks                 hooks
+		// txLocks protect the `Session.Update` of a database which is not `Transactional`.
+		txLocks [txLocksLen]sync.Mutex
+		// localLocks are the `Session.Lock` locks of a database which is not a `Locker`.
+		localLocks localLocker
+		// ownersMu protects the owners' indexes, see `Session.SetOwner`.
+		ownersMu sync.Mutex
+		// metrics receives the measurements, see `Sessions.UseMetrics`.
+		metrics Metrics
+		// started reports whether a session is started, the `Sessions.UseMetrics` should be called before.
+		started atomic.Bool
 	}
 )
 
 // newProvider returns a new sessions provider
-func newProvider() *provider {
+func newProvider(config *Config) *provider {
 	return &provider{
+		config:   config,
 		sessions: make(map[string]*Session, 0),
 		db:       newMemDB(),
+		metrics:  noMetrics{},
 	}
 }
 
 // RegisterDatabase sets a session database.
-func (p *provider) RegisterDatabase(db Database) {
+func (p *provider) RegisterDatabase(db DatabaseContext) {
 	p.mu.Lock() // for any case
-	p.db = db
+	p.db = p.measure(db)
 	p.mu.Unlock()
 }
 
-// newSession returns a new session from sessionid
-func (p *provider) newSession(sid string, expires time.Duration) *Session {
+// newSession returns a new session from sessionid,
+// it reports whether a stored session of the "sid" has expired while the application was down.
+func (p *provider) newSession(ctx context.Context, sid string, expires time.Duration) (*Session, bool) {
+	sess := &Session{
+		provider: p,
+		flashes:  make(map[string]*flashMessage),
+	}
+	sess.setID(sid)
+
+	if p.config.WriteBehind {
+		sess.buffer = newWriteBuffer(sess)
+	}
+
+	expired := p.acquire(ctx, sess, expires)
+	return sess, expired
+}
+
+// acquire receives the lifetime of the "sess" from the database and starts it,
+// it reports whether the stored session has expired while the application was down, so it's released.
+func (p *provider) acquire(ctx context.Context, sess *Session, expires time.Duration) (expired bool) {
+	sid := sess.ID()
 	onExpire := func() {
-		p.Destroy(sid)
+		p.Destroy(sid, ReasonExpired)
 	}
 
-	lifetime := p.db.Acquire(sid, expires)
+	if p.config.IdleTimeout > 0 {
+		// the server-side lifetime is controlled by the idle timeout.
+		expires = p.config.IdleTimeout
+	}
+
+	var (
+		created  time.Time
+		absolute time.Time
+		stored   bool
+	)
+
+	if p.config.AbsoluteTimeout > 0 {
+		created, stored = p.loadCreated(ctx, sid)
+		if stored && time.Since(created) >= p.config.AbsoluteTimeout {
+			// the session reached its hard limit while the application was down.
+			p.release(ctx, sid, ReasonExpired)
+			stored, expired = false, true
+		}
+
+		if !stored {
+			created = time.Now()
+		}
+
+		absolute = created.Add(p.config.AbsoluteTimeout)
+		expires = (&LifeTime{absolute: absolute}).limit(expires)
+	}
+
+	lifetime, err := p.db.AcquireContext(ctx, sid, expires)
+	if err == nil && !lifetime.IsZero() && !lifetime.Time.After(time.Now()) {
+		// the stored session's time-to-live has ended while the application was down.
+		p.release(ctx, sid, ReasonBackendExpired)
+		expired = true
+		lifetime, err = p.db.AcquireContext(ctx, sid, expires)
+	}
+
+	if err != nil {
+		// the database is not able to serve the session's lifetime,
+		// let the session manager handle it.
+		lifetime = LifeTime{}
+	}
+	lifetime.absolute = absolute
 
 	// simple and straight:
 	if !lifetime.IsZero() {
@@ -58,26 +134,117 @@ func (p *provider) newSession(sid string, expires time.Duration) *Session {
 		lifetime.Begin(expires, onExpire)
 	}
 
-	sess := &Session{
-		sid:      sid,
-		provider: p,
-		flashes:  make(map[string]*flashMessage),
-		Lifetime: lifetime,
+	sess.mu.Lock()
+	sess.Lifetime = lifetime
+	sess.created = created
+	sess.mu.Unlock()
+
+	if p.config.AbsoluteTimeout > 0 && !stored {
+		p.saveCreated(ctx, sess)
 	}
 
-	return sess
+	return
+}
+
+// loadCreated returns the stored creation time of a session, if any.
+func (p *provider) loadCreated(ctx context.Context, sid string) (time.Time, bool) {
+	v, err := p.db.GetContext(ctx, sid, createdKey)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return parseCreated(v)
+}
+
+// parseCreated parses a stored creation time, see `saveCreated`.
+func parseCreated(v interface{}) (time.Time, bool) {
+	str, ok := v.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	created, err := time.Parse(time.RFC3339Nano, str)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return created, true
+}
+
+// saveCreated stores the creation time of the "sess" to the database,
+// it does nothing if the `Config.AbsoluteTimeout` is missing.
+func (p *provider) saveCreated(ctx context.Context, sess *Session) error {
+	if sess.created.IsZero() {
+		return nil
+	}
+
+	// as string, so any database encoder can keep it as it's.
+	return sess.database().SetContext(ctx, sess.ID(), sess.lifetime(), createdKey, sess.created.Format(time.RFC3339Nano), false)
+}
+
+// exists reports whether the database knows the "sid", see `Exister`.
+func (p *provider) exists(ctx context.Context, sid string) bool {
+	if exister, ok := optional[Exister](p.db); ok {
+		exists, err := exister.Exists(ctx, sid)
+		return exists && err == nil
+	}
+
+	n, err := p.db.LenContext(ctx, sid)
+	return n > 0 && err == nil
+}
+
+// isEmpty reports whether the session has no values, the reserved keys are not counted.
+func (p *provider) isEmpty(ctx context.Context, sid string) bool {
+	empty := true
+	p.db.VisitContext(ctx, sid, func(key string, _ interface{}) {
+		if !isReservedKey(key) {
+			empty = false
+		}
+	})
+
+	return empty
 }
 
 // Init creates the session  and returns it
-func (p *provider) Init(sid string, expires time.Duration) *Session {
-	newSession := p.newSession(sid, expires)
+func (p *provider) Init(ctx context.Context, sid string, expires time.Duration) *Session {
+	_, disabled := p.metrics.(noMetrics)
+	tracked := !disabled || len(p.hooks.create) > 0 || len(p.hooks.load) > 0
+
+	// checked before the session's entry is acquired, a session with only flash messages
+	// or reserved keys, i.e. its owner, is stored too.
+	stored := tracked && p.exists(ctx, sid)
+
+	newSession, expired := p.newSession(ctx, sid, expires)
 	p.mu.Lock()
 	p.sessions[sid] = newSession
 	p.mu.Unlock()
+
+	if tracked {
+		if !stored || expired {
+			p.metrics.SessionCreated()
+			fireSession(p.hooks.create, newSession)
+		} else { // i.e. after a restart.
+			p.metrics.SessionLoaded()
+			fireSession(p.hooks.load, newSession)
+		}
+	}
+
 	return newSession
 }
 
-// ErrNotFound can be returned when calling `UpdateExpiration` on a non-existing or invalid session entry.
+// persist stores the lazy session "sess" to the database, see `Config.Lazy`.
+func (p *provider) persist(ctx context.Context, sess *Session, expires time.Duration) {
+	p.acquire(ctx, sess, expires)
+	p.mu.Lock()
+	p.sessions[sess.ID()] = sess
+	p.mu.Unlock()
+
+	p.metrics.SessionCreated()
+	fireSession(p.hooks.create, sess)
+}
+
+// ErrNotFound can be returned when calling `UpdateExpiration` on a non-existing or invalid session entry
+// and by the `DatabaseContext` and the session's `GetE` when a key does not exist.
 // It can be matched directly, i.e: `isErrNotFound := sessions.ErrNotFound.Equal(err)`.
 var ErrNotFound = errors.New("not found")
 
@@ -89,7 +256,7 @@ var ErrNotFound = errors.New("not found")
 // because the call of the provider's `UpdateExpiration` is always called when the client has a valid session cookie.
 //
 // If a backend database is used then it may return an `ErrNotImplemented` error if the underline database does not support this operation.
-func (p *provider) UpdateExpiration(sid string, expires time.Duration) error {
+func (p *provider) UpdateExpiration(ctx context.Context, sid string, expires time.Duration) error {
 	if expires <= 0 {
 		return nil
 	}
@@ -101,22 +268,238 @@ func (p *provider) UpdateExpiration(sid string, expires time.Duration) error {
 		return ErrNotFound
 	}
 
-	sess.Lifetime.Shift(expires)
-	return p.db.OnUpdateExpiration(sid, expires)
+	// the absolute timeout can not be extended.
+	sess.mu.Lock()
+	if expires = sess.Lifetime.limit(expires); expires > 0 {
+		sess.Lifetime.Shift(expires)
+	}
+	sess.mu.Unlock()
+
+	if expires <= 0 {
+		return ErrNotFound
+	}
+
+	if err := p.db.OnUpdateExpirationContext(ctx, sid, expires); err != nil {
+		return err
+	}
+
+	fireSession(p.hooks.expiration, sess)
+	return nil
+}
+
+// touch moves the expiration of the "sess" forward
+// based on the `Config.IdleTimeout` or the `Config.Expires` on `Config.SlidingExpiration`.
+// On `Config.SlidingExpiration` the expiration is moved only when the remaining lifetime
+// drops below the `Config.SlidingRefreshFraction` of it, so the database is not touched on every request.
+// It reports whether the expiration was moved.
+func (p *provider) touch(ctx context.Context, sess *Session) bool {
+	d := p.config.IdleTimeout
+	if d <= 0 && p.config.SlidingExpiration {
+		d = p.config.Expires
+	}
+
+	if d <= 0 {
+		return false
+	}
+
+	// the lifetime is moved under the session's lock, it's shared by the concurrent requests
+	// of the session and its expiration timer.
+	sess.mu.Lock()
+	if p.config.SlidingExpiration && !sess.Lifetime.IsZero() {
+		threshold := time.Duration(float64(d) * p.config.SlidingRefreshFraction)
+		if sess.Lifetime.DurationUntilExpiration() >= threshold {
+			sess.mu.Unlock()
+			return false
+		}
+	}
+
+	expires := sess.Lifetime.limit(d)
+	if expires > 0 {
+		sess.Lifetime.Shift(expires)
+	}
+	sess.mu.Unlock()
+
+	if expires <= 0 {
+		return false
+	}
+
+	sess.database().OnUpdateExpirationContext(ctx, sess.ID(), expires)
+	fireSession(p.hooks.expiration, sess)
+	return true
+}
+
+// ErrSessionExists is returned by `Regenerate` when the generated session id is already in use.
+var ErrSessionExists = errors.New("session id already exists")
+
+// Regenerate moves the session "sess" under a fresh session id,
+// generated by the `Config.SessionIDGenerator`.
+// The stored values, the flash messages and the remaining lifetime are kept,
+// the old session id is released from the database.
+func (p *provider) Regenerate(ctx context.Context, sess *Session) error {
+	oldSid := sess.ID()
+	if err := p.regenerate(ctx, sess); err != nil {
+		return err
+	}
+
+	// the owner's index should point to the new session id.
+	if owner := ownerOf(ctx, sess.database(), sess.ID()); owner != "" {
+		return p.reindexOwner(ctx, owner, oldSid, sess.ID())
+	}
+
+	return nil
+}
+
+func (p *provider) regenerate(ctx context.Context, sess *Session) error {
+	newSid := p.config.SessionIDGenerator()
+
+	if sess.isPending() { // lazy session, there is nothing stored yet.
+		if newSid == "" || newSid == sess.ID() {
+			return ErrSessionExists
+		}
+
+		sess.mu.Lock()
+		sess.setID(newSid)
+		sess.mu.Unlock()
+		return nil
+	}
+
+	if db, ok := sess.db.(*cookieDatabase); ok { // client-side session, there is no entry to move.
+		if newSid == "" || newSid == sess.ID() {
+			return ErrSessionExists
+		}
+
+		return db.regenerate(ctx, sess, newSid)
+	}
+
+	if err := sess.CommitContext(ctx); err != nil { // the values are moved through the database.
+		return err
+	}
+
+	oldSid := sess.ID()
+	if newSid == "" || newSid == oldSid {
+		return ErrSessionExists
+	}
+
+	// reserve the new session id, it's not known by any client yet,
+	// the values are moved through the database outside of the provider's lock.
+	p.mu.Lock()
+	if _, exists := p.sessions[newSid]; exists {
+		p.mu.Unlock()
+		return ErrSessionExists
+	}
+	p.sessions[newSid] = sess
+	p.mu.Unlock()
+
+	if err := p.moveValues(ctx, sess, oldSid, newSid); err != nil {
+		p.mu.Lock()
+		delete(p.sessions, newSid)
+		p.mu.Unlock()
+		return err
+	}
+
+	p.mu.Lock()
+	delete(p.sessions, oldSid)
+	p.mu.Unlock()
+
+	sess.mu.Lock()
+	sess.setID(newSid)
+	// re-arm the timer so it destroys the new session id on expiration.
+	sess.Lifetime.stop()
+	sess.Lifetime.Revive(func() {
+		p.Destroy(newSid, ReasonExpired)
+	})
+	sess.mu.Unlock()
+	return nil
+}
+
+// moveValues moves the stored values of the "sess" from the "oldSid" to the "newSid" entry of the database.
+func (p *provider) moveValues(ctx context.Context, sess *Session, oldSid, newSid string) error {
+	// collect the values first, some databases (e.g. boltdb)
+	// can't write while they are still reading.
+	values := make(map[string]interface{})
+	err := p.db.VisitContext(ctx, oldSid, func(key string, value interface{}) {
+		values[key] = value
+	})
+	if err != nil {
+		return err
+	}
+
+	lifetime := sess.lifetime()
+	var expires time.Duration
+	if !lifetime.IsZero() {
+		if expires = lifetime.DurationUntilExpiration(); expires <= 0 {
+			return ErrNotFound // already expired.
+		}
+	}
+
+	if _, err = p.db.AcquireContext(ctx, newSid, expires); err != nil {
+		return err
+	}
+
+	for key, value := range values {
+		if err = p.db.SetContext(ctx, newSid, lifetime, key, value, isImmutable(p.db, oldSid, key)); err != nil {
+			p.db.ReleaseContext(ctx, newSid)
+			return err
+		}
+	}
+
+	if err = p.db.ReleaseContext(ctx, oldSid); err != nil {
+		p.db.ReleaseContext(ctx, newSid)
+		return err
+	}
+
+	return nil
 }
 
-// Read returns the store which sid parameter belongs
-func (p *provider) Read(sid string, expires time.Duration) *Session {
+// Read returns the store which sid parameter belongs,
+// it reports whether the expiration of an existing session was moved forward, see `touch`.
+// On `Config.Strict` it returns a nil session if the "sid" is not known by the database.
+// It returns a nil session if the "verify", i.e. the fingerprint check, does not accept it,
+// before its expiration is moved, so a rejected request does not keep the session alive.
+func (p *provider) Read(ctx context.Context, sid string, expires time.Duration, verify func(*Session) bool) (*Session, bool) {
 	p.mu.Lock()
 	if sess, found := p.sessions[sid]; found {
-		sess.runFlashGC() // run the flash messages GC, new request here of existing session
+		if lifetime := sess.lifetime(); lifetime.HasExpired() { // the timer did not run yet.
+			p.mu.Unlock()
+			p.deleteSession(sess, ReasonExpired)
+
+			return p.Init(ctx, sid, expires), false
+		}
 		p.mu.Unlock()
 
-		return sess
+		if p.destroyedElsewhere(ctx, sess) {
+			return p.Read(ctx, sid, expires, verify)
+		}
+
+		if verify != nil && !verify(sess) {
+			return nil, false
+		}
+
+		p.metrics.SessionRead()
+
+		if sess.buffer != nil { // load the values once per request.
+			sess.buffer.reset()
+		}
+
+		sess.runFlashGC() // run the flash messages GC, new request here of existing session
+		p.touchOwner(ctx, sess)
+		return sess, p.touch(ctx, sess)
 	}
 	p.mu.Unlock()
 
-	return p.Init(sid, expires) // if not found create new
+	if p.config.Strict && !p.exists(ctx, sid) {
+		// unknown or forged session id, do not accept it.
+		return nil, false
+	}
+
+	sess := p.Init(ctx, sid, expires) // if not found create new
+	if verify != nil && !verify(sess) {
+		return nil, false
+	}
+
+	sess.runFlashGC() // i.e. flash messages set before a restart.
+	p.touchOwner(ctx, sess)
+	return sess, false
 }
 
 func (p *provider) registerDestroyListener(ln DestroyListener) {
@@ -126,21 +509,104 @@ func (p *provider) registerDestroyListener(ln DestroyListener) {
 	p.destroyListeners = append(p.destroyListeners, ln)
 }
 
-func (p *provider) fireDestroy(sid string) {
+func (p *provider) registerDestroyEventListener(ln DestroyEventListener) {
+	if ln == nil {
+		return
+	}
+	p.destroyEventListeners = append(p.destroyEventListeners, ln)
+}
+
+func (p *provider) fireDestroy(evt DestroyEvent) {
+	p.metrics.SessionDestroyed(evt.Reason)
+
 	for _, ln := range p.destroyListeners {
-		ln(sid)
+		ln(evt.ID)
 	}
+
+	for _, ln := range p.destroyEventListeners {
+		ln(evt)
+	}
+}
+
+// snapshot returns a copy of the session's values stored to the "db",
+// only if there are destroy event listeners to receive them.
+func (p *provider) snapshot(ctx context.Context, db DatabaseContext, sid string) Store {
+	if len(p.destroyEventListeners) == 0 {
+		return nil
+	}
+
+	var values Store
+	db.VisitContext(ctx, sid, func(key string, value interface{}) {
+		if !isReservedKey(key) {
+			values.Save(key, value, false)
+		}
+	})
+
+	return values
+}
+
+// release removes a session which is not loaded in memory from the database,
+// i.e. a session found expired before its load.
+func (p *provider) release(ctx context.Context, sid string, reason DestroyReason) {
+	values := p.snapshot(ctx, p.db, sid)
+	owner := ownerOf(ctx, p.db, sid)
+	p.db.ReleaseContext(ctx, sid)
+	p.unindexOwner(ctx, owner, sid)
+	p.fireDestroy(DestroyEvent{ID: sid, Reason: reason, Values: values})
+}
+
+// destroyedElsewhere reports whether the in-memory session "sess" has been removed from a shared database,
+// i.e. destroyed by another instance of the application through the `DestroyOwner`,
+// if so it's removed from the memory too.
+// It's checked only on `Config.VerifyExists` and for databases which implement the `Exister` interface.
+func (p *provider) destroyedElsewhere(ctx context.Context, sess *Session) bool {
+	if !p.config.VerifyExists || sess.isPending() {
+		return false
+	}
+
+	if _, isMem := unwrapDatabase(p.db).(*mem); isMem {
+		return false
+	}
+
+	exister, ok := optional[Exister](p.db)
+	if !ok {
+		return false
+	}
+
+	if exists, err := exister.Exists(ctx, sess.ID()); exists || err != nil {
+		return false
+	}
+
+	p.mu.Lock()
+	if p.sessions[sess.ID()] == sess {
+		delete(p.sessions, sess.ID())
+
+		sess.mu.Lock()
+		sess.Lifetime.stop()
+		sess.mu.Unlock()
+	}
+	p.mu.Unlock()
+	return true
 }
 
 // Destroy destroys the session, removes all sessions and flash values,
 // the session itself and updates the registered session databases,
 // this called from sessionManager which removes the client's cookie also.
-func (p *provider) Destroy(sid string) {
+// A session which is not loaded in memory, i.e. a session of another instance of the application,
+// is released from the database.
+func (p *provider) Destroy(sid string, reason DestroyReason) {
 	p.mu.Lock()
-	if sess, found := p.sessions[sid]; found {
-		p.deleteSession(sess)
-	}
+	sess, found := p.sessions[sid]
 	p.mu.Unlock()
+
+	if found {
+		p.deleteSession(sess, reason)
+		return
+	}
+
+	if ctx := context.Background(); p.exists(ctx, sid) {
+		p.release(ctx, sid, reason)
+	}
 }
 
 // DestroyAll removes all sessions
@@ -148,16 +614,52 @@ func (p *provider) Destroy(sid string) {
 // Client's session cookie will still exist but it will be reseted on the next request.
 func (p *provider) DestroyAll() {
 	p.mu.Lock()
+	sessions := make([]*Session, 0, len(p.sessions))
 	for _, sess := range p.sessions {
-		p.deleteSession(sess)
+		sessions = append(sessions, sess)
 	}
 	p.mu.Unlock()
+
+	for _, sess := range sessions {
+		p.deleteSession(sess, ReasonDestroyAll)
+	}
 }
 
-func (p *provider) deleteSession(sess *Session) {
-	sid := sess.sid
+// deleteSession removes the "sess" from the memory and the database and it fires the destroy event, once.
+// The memory is locked only to remove the session from it, the database and the listeners
+// are called after, so a listener can use the manager, i.e. its `Count`.
+func (p *provider) deleteSession(sess *Session, reason DestroyReason) {
+	sid := sess.ID()
+
+	sess.lazyMu.Lock()
+	stored := sess.pending == nil
+	sess.pending = nil // a lazy session should not be stored after its destruction.
+	sess.idPending = false
+	destroyed := sess.destroyed
+	sess.destroyed = true
+	sess.lazyMu.Unlock()
+
+	if destroyed { // i.e. by a concurrent request.
+		return
+	}
+
+	p.mu.Lock()
+	if p.sessions[sid] == sess {
+		delete(p.sessions, sid)
+	}
+	p.mu.Unlock()
+
+	if !stored && sess.db == nil { // lazy session, there is nothing to release.
+		return
+	}
+
+	// the snapshot is taken before the release, so the listeners can see the values.
+	ctx := context.Background()
+	db := sess.database()
+	values := p.snapshot(ctx, db, sid)
+	owner := ownerOf(ctx, db, sid)
 
-	delete(p.sessions, sid)
-	p.db.Release(sid)
-	p.fireDestroy(sid)
+	db.ReleaseContext(ctx, sid)
+	p.unindexOwner(ctx, owner, sid)
+	p.fireDestroy(DestroyEvent{ID: sid, Reason: reason, Values: values})
 }
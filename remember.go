@@ -0,0 +1,461 @@
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// DefaultRememberCookieName is the default cookie name of the remember-me token, see `RememberMe`.
+const DefaultRememberCookieName = "gosessionremember"
+
+// rememberIDPrefix is the prefix of the database entries of the remember-me tokens,
+// each series of tokens is stored as a database session.
+const rememberIDPrefix = reservedKeyPrefix + "remember_"
+
+// rememberKey is the reserved key of the remember-me series which a session is bound to.
+const rememberKey = reservedKeyPrefix + "remember"
+
+// rememberGrace is the duration that the previous token of a series is still accepted after its rotation,
+// so the concurrent requests of the same client do not look like a theft.
+const rememberGrace = 30 * time.Second
+
+// the keys of a series entry.
+const (
+	rememberOwnerKey     = "owner"
+	rememberValidatorKey = "validator"
+	rememberPreviousKey  = "previous"
+	rememberRotatedKey   = "rotated"
+	rememberExpiresKey   = "expires"
+)
+
+// RememberMe keeps the users logged in after their sessions have expired,
+// through a long-lived token which travels in its own cookie, see `Sessions.UseRememberMe`.
+//
+// The token is a selector, which identifies a series of tokens, and a validator,
+// only the hash of the validator is stored to the registered database.
+// The validator is rotated on each use, a token which is used after its rotation is considered stolen
+// and the whole series is revoked.
+type RememberMe struct {
+	// Cookie is the name of the remember-me cookie, it's kept separate from the `Config.Cookie`.
+	// The rest of the cookie's attributes follow the `Config` ones.
+	//
+	// Defaults to "gosessionremember".
+	Cookie string
+	// Expires is the lifetime of a series of tokens since the `Remember`,
+	// the rotations do not extend it.
+	//
+	// Defaults to 30 days.
+	Expires time.Duration
+	// Restore is called when a new session is built from a valid token,
+	// it receives the user id given to the `Remember`, i.e. to store the logged-in user to the session.
+	Restore func(sess *Session, userID string)
+	// OnTheft is called when a stolen token is detected, the series is already revoked,
+	// i.e. to destroy the rest of the user's sessions through the `DestroyOwner`.
+	OnTheft func(userID string)
+}
+
+// rememberMe is the remember-me subsystem of a manager.
+type rememberMe struct {
+	RememberMe
+	transport *CookieTransport
+}
+
+// UseRememberMe enables the remember-me tokens, see `RememberMe` and `Remember`.
+func UseRememberMe(rm RememberMe) {
+	Default.UseRememberMe(rm)
+}
+
+// UseRememberMe enables the remember-me tokens, see `RememberMe` and `Remember`.
+func (s *Sessions) UseRememberMe(rm RememberMe) {
+	if rm.Cookie == "" {
+		rm.Cookie = DefaultRememberCookieName
+	}
+
+	if rm.Expires <= 0 {
+		rm.Expires = 30 * 24 * time.Hour
+	}
+
+	config := s.config
+	config.Cookie = rm.Cookie
+	s.remember = &rememberMe{RememberMe: rm, transport: NewCookieTransport(config)}
+}
+
+func rememberID(selector string) string {
+	return rememberIDPrefix + selector
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func hashValidator(validator string) string {
+	sum := sha256.Sum256([]byte(validator))
+	return hex.EncodeToString(sum[:])
+}
+
+func equalHash(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// parseRememberToken returns the selector and the validator of a token.
+func parseRememberToken(token string) (selector, validator string, ok bool) {
+	selector, validator, ok = strings.Cut(token, ":")
+	if !ok || len(selector) != 32 || validator == "" {
+		return "", "", false
+	}
+
+	if _, err := hex.DecodeString(selector); err != nil {
+		return "", "", false
+	}
+
+	return selector, validator, true
+}
+
+// rememberSeries is a stored series of tokens.
+type rememberSeries struct {
+	owner     string
+	validator string
+	previous  string
+	rotated   time.Time
+	expires   time.Time
+}
+
+func parseUnixNano(v interface{}) time.Time {
+	str, _ := v.(string)
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return time.Unix(0, n)
+}
+
+func formatUnixNano(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+// loadSeries reads the series "id" from the database,
+// it reports false if it does not exist or it has expired, an expired series is released.
+func (p *provider) loadSeries(ctx context.Context, id string) (rememberSeries, bool) {
+	var series rememberSeries
+	if !p.exists(ctx, id) {
+		return series, false
+	}
+
+	err := p.db.VisitContext(ctx, id, func(key string, value interface{}) {
+		str, _ := value.(string)
+		switch key {
+		case rememberOwnerKey:
+			series.owner = str
+		case rememberValidatorKey:
+			series.validator = str
+		case rememberPreviousKey:
+			series.previous = str
+		case rememberRotatedKey:
+			series.rotated = parseUnixNano(value)
+		case rememberExpiresKey:
+			series.expires = parseUnixNano(value)
+		}
+	})
+
+	if err != nil || series.validator == "" {
+		return series, false
+	}
+
+	if !series.expires.After(time.Now()) {
+		p.db.ReleaseContext(ctx, id)
+		return series, false
+	}
+
+	return series, true
+}
+
+// saveSeries stores the "values" of the series "id", as strings, so any database encoder can keep them as they're.
+func (p *provider) saveSeries(ctx context.Context, id string, expires time.Time, values map[string]string) error {
+	for key, value := range values {
+		if err := p.db.SetContext(ctx, id, LifeTime{Time: expires}, key, value, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// startSeries starts a new series of tokens of the "userID" and it binds the "sess" to it,
+// the previous series of the session, if any, is revoked.
+// It returns the token and the lifetime of its cookie.
+func (s *Sessions) startSeries(ctx context.Context, sess *Session, userID string) (string, time.Duration, error) {
+	sess.persist(ctx)
+
+	if v, err := sess.database().GetContext(ctx, sess.ID(), rememberKey); err == nil {
+		if selector, ok := v.(string); ok {
+			s.provider.db.ReleaseContext(ctx, rememberID(selector))
+		}
+	}
+
+	selector, err := randomHex(16)
+	if err != nil {
+		return "", 0, err
+	}
+
+	validator, err := randomHex(32)
+	if err != nil {
+		return "", 0, err
+	}
+
+	id := rememberID(selector)
+	expires := time.Now().Add(s.remember.Expires)
+	if _, err = s.provider.db.AcquireContext(ctx, id, s.remember.Expires); err != nil {
+		return "", 0, err
+	}
+
+	err = s.provider.saveSeries(ctx, id, expires, map[string]string{
+		rememberOwnerKey:     userID,
+		rememberValidatorKey: hashValidator(validator),
+		rememberRotatedKey:   formatUnixNano(time.Now()),
+		rememberExpiresKey:   formatUnixNano(expires),
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	if err = sess.database().SetContext(ctx, sess.ID(), sess.lifetime(), rememberKey, selector, false); err != nil {
+		return "", 0, err
+	}
+
+	return selector + ":" + validator, s.remember.Expires, nil
+}
+
+// restoreRemembered builds the "sess" from the remember-me "token", if the session is not bound to a series yet.
+// The token is rotated and the new one is given to the "send",
+// the "remove" is called when the token is not valid anymore.
+func (s *Sessions) restoreRemembered(ctx context.Context, sess *Session, token string, send func(token string, expires time.Duration), remove func()) {
+	if s.remember == nil || token == "" {
+		return
+	}
+
+	if _, err := sess.database().GetContext(ctx, sess.ID(), rememberKey); err == nil {
+		return // already restored or remembered.
+	}
+
+	selector, validator, ok := parseRememberToken(token)
+	if !ok {
+		remove()
+		return
+	}
+
+	// the rotation of a series should not race with another instance of the application.
+	id := rememberID(selector)
+	locker := s.provider.locker()
+	lockToken, err := locker.LockContext(ctx, id, s.config.LockLease)
+	if err != nil {
+		return
+	}
+	defer locker.UnlockContext(ctx, id, lockToken)
+
+	series, ok := s.provider.loadSeries(ctx, id)
+	if !ok {
+		remove()
+		return
+	}
+
+	hash := hashValidator(validator)
+	switch {
+	case equalHash(hash, series.validator):
+		newValidator, err := randomHex(32)
+		if err != nil {
+			return
+		}
+
+		err = s.provider.saveSeries(ctx, id, series.expires, map[string]string{
+			rememberValidatorKey: hashValidator(newValidator),
+			rememberPreviousKey:  series.validator,
+			rememberRotatedKey:   formatUnixNano(time.Now()),
+		})
+		if err != nil {
+			return
+		}
+
+		send(selector+":"+newValidator, time.Until(series.expires))
+	case series.previous != "" && equalHash(hash, series.previous) && time.Since(series.rotated) < rememberGrace:
+		// a concurrent request of the same client, the rotated token is sent by the other response.
+	default:
+		// an old token is used after its rotation, it has been stolen.
+		s.provider.db.ReleaseContext(ctx, id)
+		remove()
+
+		if s.remember.OnTheft != nil {
+			s.remember.OnTheft(series.owner)
+		}
+		return
+	}
+
+	sess.persist(ctx)
+	sess.database().SetContext(ctx, sess.ID(), sess.lifetime(), rememberKey, selector, false)
+
+	if s.remember.Restore != nil {
+		s.remember.Restore(sess, series.owner)
+	}
+}
+
+// restore builds the net/http session "sess" from the remember-me cookie, see `restoreRemembered`.
+func (s *Sessions) restore(w http.ResponseWriter, r *http.Request, sess *Session) {
+	if s.remember == nil {
+		return
+	}
+
+	t := s.remember.transport
+	s.restoreRemembered(r.Context(), sess, t.Get(r), func(token string, expires time.Duration) {
+		t.Set(w, r, token, expires)
+	}, func() {
+		t.Remove(w, r)
+	})
+}
+
+// restoreFasthttp builds the valyala/fasthttp session "sess" from the remember-me cookie, see `restoreRemembered`.
+func (s *Sessions) restoreFasthttp(ctx *fasthttp.RequestCtx, sess *Session) {
+	if s.remember == nil {
+		return
+	}
+
+	t := s.remember.transport
+	s.restoreRemembered(ctx, sess, t.GetFasthttp(ctx), func(token string, expires time.Duration) {
+		t.SetFasthttp(ctx, token, expires)
+	}, func() {
+		t.RemoveFasthttp(ctx)
+	})
+}
+
+// Remember sends a remember-me token of the "userID" to the client, i.e. on a login with a "remember me" checkbox,
+// so a new session is built from it, through the `RememberMe.Restore`, when the current session has expired.
+// It requires the `UseRememberMe`.
+//
+// The token is bound to the session of the request, see `Start`, so a session which is already started
+// in the same request should be served by the `Handler` middleware or the `Config.AllowReclaim` should be true.
+func Remember(w http.ResponseWriter, r *http.Request, userID string) error {
+	return Default.Remember(w, r, userID)
+}
+
+// Remember sends a remember-me token of the "userID" to the client, i.e. on a login with a "remember me" checkbox,
+// so a new session is built from it, through the `RememberMe.Restore`, when the current session has expired.
+// It requires the `UseRememberMe`.
+//
+// The token is bound to the session of the request, see `Start`, so a session which is already started
+// in the same request should be served by the `Handler` middleware or the `Config.AllowReclaim` should be true.
+func (s *Sessions) Remember(w http.ResponseWriter, r *http.Request, userID string) error {
+	if s.remember == nil {
+		return nil
+	}
+
+	sess := s.Start(w, r)
+	token, expires, err := s.startSeries(r.Context(), sess, userID)
+	if err != nil {
+		return err
+	}
+
+	s.remember.transport.Set(w, r, token, expires)
+
+	if s.cookies != nil { // the session is bound to the series.
+		return s.Commit(w, r, sess)
+	}
+
+	return nil
+}
+
+// RememberFasthttp sends a remember-me token of the "userID" to the client, see `Remember`.
+func RememberFasthttp(ctx *fasthttp.RequestCtx, userID string) error {
+	return Default.RememberFasthttp(ctx, userID)
+}
+
+// RememberFasthttp sends a remember-me token of the "userID" to the client, see `Remember`.
+func (s *Sessions) RememberFasthttp(ctx *fasthttp.RequestCtx, userID string) error {
+	if s.remember == nil {
+		return nil
+	}
+
+	sess := s.StartFasthttp(ctx)
+	token, expires, err := s.startSeries(ctx, sess, userID)
+	if err != nil {
+		return err
+	}
+
+	s.remember.transport.SetFasthttp(ctx, token, expires)
+
+	if s.cookies != nil { // the session is bound to the series.
+		return s.CommitFasthttp(ctx, sess)
+	}
+
+	return nil
+}
+
+// forget revokes the series of the remember-me "token", if any,
+// and the series which the "sess" is bound to, the session is unbound from it.
+func (s *Sessions) forget(ctx context.Context, sess *Session, token string) {
+	if selector, _, ok := parseRememberToken(token); ok {
+		s.provider.db.ReleaseContext(ctx, rememberID(selector))
+	}
+
+	if v, err := sess.database().GetContext(ctx, sess.ID(), rememberKey); err == nil {
+		if selector, ok := v.(string); ok {
+			s.provider.db.ReleaseContext(ctx, rememberID(selector))
+		}
+
+		sess.database().DeleteContext(ctx, sess.ID(), rememberKey)
+	}
+}
+
+// Forget revokes the remember-me token of the client and it removes its cookie, i.e. on logout.
+func Forget(w http.ResponseWriter, r *http.Request) {
+	Default.Forget(w, r)
+}
+
+// Forget revokes the remember-me token of the client and it removes its cookie, i.e. on logout.
+// The session of the request, see `Remember`, is unbound from the token too.
+func (s *Sessions) Forget(w http.ResponseWriter, r *http.Request) {
+	if s.remember == nil {
+		return
+	}
+
+	sess := s.Start(w, r)
+	s.forget(r.Context(), sess, s.remember.transport.Get(r))
+	s.remember.transport.Remove(w, r)
+
+	if s.cookies != nil { // the session is unbound from the series.
+		s.Commit(w, r, sess)
+	}
+}
+
+// ForgetFasthttp revokes the remember-me token of the client and it removes its cookie, i.e. on logout.
+func ForgetFasthttp(ctx *fasthttp.RequestCtx) {
+	Default.ForgetFasthttp(ctx)
+}
+
+// ForgetFasthttp revokes the remember-me token of the client and it removes its cookie, i.e. on logout.
+// The session of the request, see `RememberFasthttp`, is unbound from the token too.
+func (s *Sessions) ForgetFasthttp(ctx *fasthttp.RequestCtx) {
+	if s.remember == nil {
+		return
+	}
+
+	sess := s.StartFasthttp(ctx)
+	s.forget(ctx, sess, s.remember.transport.GetFasthttp(ctx))
+	s.remember.transport.RemoveFasthttp(ctx)
+
+	if s.cookies != nil { // the session is unbound from the series.
+		s.CommitFasthttp(ctx, sess)
+	}
+}
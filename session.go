@@ -1,11 +1,29 @@
 package sessions
 
 import (
+	"context"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// reservedKeyPrefix is the prefix of the keys that the sessions manager
+// stores to the database for its own use, they are not part of the session's values.
+const reservedKeyPrefix = "_gosessions."
+
+// createdKey is the reserved key of the session's creation time.
+const createdKey = reservedKeyPrefix + "created"
+
+// flashesKey is the reserved key of the flash messages which are not read yet.
+const flashesKey = reservedKeyPrefix + "flashes"
+
+func isReservedKey(key string) bool {
+	return strings.HasPrefix(key, reservedKeyPrefix)
+}
+
 type (
 	// Session should expose the Sessions's end-user API.
 	// It is the session's storage controller which you can
@@ -13,12 +31,33 @@ type (
 	//
 	// This is what will be returned when sess := sessions.Start().
 	Session struct {
-		sid      string
+		sid      atomic.Pointer[string]
 		isNew    bool
 		flashes  map[string]*flashMessage
 		mu       sync.RWMutex // for flashes.
 		Lifetime LifeTime
 		provider *provider
+		// created is the creation time of the session,
+		// it's tracked only when `Config.AbsoluteTimeout` is set.
+		created time.Time
+		// db is the session's own database, i.e. a client-side session of the `CookieStore`,
+		// if nil then the provider's database is used instead.
+		db DatabaseContext
+		// lazyMu protects the "pending", "idPending" and "destroyed" fields,
+		// it's separated from the "mu" because the database is resolved under that lock too.
+		lazyMu sync.Mutex
+		// pending stores a lazy session on its first write, see `Config.Lazy`.
+		pending func(ctx context.Context)
+		// idPending reports whether the session id of a stored lazy session
+		// should be sent to the client by the middleware.
+		idPending bool
+		// destroyed reports whether the session is destroyed, so it's released once.
+		destroyed bool
+		// buffer keeps the changes of the session until its commit, see `Config.WriteBehind`.
+		buffer *writeBuffer
+		// flashesLoaded reports whether the flash messages of a server-side session
+		// are loaded from the database, they are loaded on their first use of each request.
+		flashesLoaded bool
 	}
 
 	flashMessage struct {
@@ -37,12 +76,84 @@ type (
 //
 // Use the session's manager `Destroy(ctx)` in order to remove the cookie as well.
 func (s *Session) Destroy() {
-	s.provider.deleteSession(s)
+	s.provider.deleteSession(s, ReasonDestroy)
+}
+
+// Regenerate moves this session under a fresh session id,
+// the values, the flash messages and the lifetime are kept.
+// Call it right after a privilege change (e.g. login)
+// in order to protect against session fixation attacks.
+//
+// Note that this method does NOT update the client's cookie,
+// use the session's manager `Regenerate(w, r)` in order to send the new id to the client as well.
+func (s *Session) Regenerate() error {
+	return s.provider.Regenerate(context.Background(), s)
+}
+
+// database returns the database which this session's values are stored.
+func (s *Session) database() DatabaseContext {
+	if s.db != nil {
+		return s.db
+	}
+
+	if s.isPending() {
+		return emptyDatabase{}
+	}
+
+	if s.buffer != nil {
+		return s.buffer
+	}
+
+	return s.provider.db
+}
+
+// lifetime returns a copy of the session's lifetime, under the session's lock,
+// as the concurrent requests of the session and its expiration timer move it.
+func (s *Session) lifetime() LifeTime {
+	s.mu.RLock()
+	lt := s.Lifetime
+	s.mu.RUnlock()
+	return lt
+}
+
+// isPending reports whether this is a lazy session which is not stored yet.
+func (s *Session) isPending() bool {
+	s.lazyMu.Lock()
+	pending := s.pending != nil
+	s.lazyMu.Unlock()
+	return pending
+}
+
+// persist stores this lazy session, if it's not stored yet.
+func (s *Session) persist(ctx context.Context) {
+	s.lazyMu.Lock()
+	pending := s.pending
+	s.pending = nil
+	s.lazyMu.Unlock()
+
+	if pending != nil {
+		pending(ctx)
+	}
+}
+
+// takeIDPending reports whether the session id should be sent to the client, once.
+func (s *Session) takeIDPending() bool {
+	s.lazyMu.Lock()
+	idPending := s.idPending
+	s.idPending = false
+	s.lazyMu.Unlock()
+	return idPending
 }
 
 // ID returns the session's ID.
 func (s *Session) ID() string {
-	return s.sid
+	return *s.sid.Load()
+}
+
+// setID replaces the session's ID atomically,
+// the `Regenerate` of a request changes it while concurrent requests of the session read it.
+func (s *Session) setID(sid string) {
+	s.sid.Store(&sid)
 }
 
 // IsNew returns true if this session is
@@ -53,22 +164,91 @@ func (s *Session) IsNew() bool {
 
 // Get returns a value based on its "key".
 func (s *Session) Get(key string) interface{} {
-	return s.provider.db.Get(s.sid, key)
+	v, _ := s.GetE(context.Background(), key)
+	return v
+}
+
+// GetE returns a value based on its "key".
+// Unlike `Get`, it reports an `ErrNotFound` if the "key" does not exist
+// or any error coming from the registered database.
+func (s *Session) GetE(ctx context.Context, key string) (interface{}, error) {
+	return s.database().GetContext(ctx, s.ID(), key)
 }
 
 // when running on the session manager removes any 'old' flash messages.
+// The flash messages of a server-side session are loaded from the database on their first use, see `loadFlashes`,
+// so the ones set by another instance of the application are available as well.
 func (s *Session) runFlashGC() {
 	s.mu.Lock()
-	for key, v := range s.flashes {
-		if v.shouldRemove {
-			delete(s.flashes, key)
+	if s.db == nil { // the database keeps only the flash messages that are not read yet.
+		s.flashesLoaded = false
+	} else { // client-side session, the flash messages are part of its cookie.
+		for key, v := range s.flashes {
+			if v.shouldRemove {
+				delete(s.flashes, key)
+			}
+		}
+	}
+	s.mu.Unlock()
+}
+
+// loadFlashes loads the flash messages of a server-side session from the database,
+// once per request, so a request which does not use them does not read them.
+func (s *Session) loadFlashes(ctx context.Context) {
+	if s.db != nil { // client-side session, the flash messages are part of its cookie.
+		return
+	}
+
+	s.mu.RLock()
+	loaded := s.flashesLoaded
+	s.mu.RUnlock()
+	if loaded {
+		return
+	}
+
+	stored, _ := s.database().GetContext(ctx, s.ID(), flashesKey)
+	values, _ := stored.(map[string]interface{})
+
+	s.mu.Lock()
+	if !s.flashesLoaded {
+		s.flashes = make(map[string]*flashMessage, len(values))
+		for key, value := range values {
+			s.flashes[key] = &flashMessage{value: value}
 		}
+		s.flashesLoaded = true
 	}
 	s.mu.Unlock()
 }
 
+// saveFlashes stores the flash messages that are not read yet to the database,
+// so they survive a restart and they are available to the next request
+// even if it's served by another instance of the application.
+func (s *Session) saveFlashes(ctx context.Context) {
+	if s.db != nil { // client-side session, the flash messages are part of its cookie.
+		return
+	}
+
+	s.mu.RLock()
+	values := make(map[string]interface{}, len(s.flashes))
+	for key, v := range s.flashes {
+		if !v.shouldRemove {
+			values[key] = v.value
+		}
+	}
+	s.mu.RUnlock()
+
+	if len(values) == 0 {
+		s.database().DeleteContext(ctx, s.ID(), flashesKey)
+		return
+	}
+
+	s.database().SetContext(ctx, s.ID(), s.lifetime(), flashesKey, values, false)
+}
+
 // HasFlash returns true if this session has available flash messages.
 func (s *Session) HasFlash() bool {
+	s.loadFlashes(context.Background())
+
 	s.mu.RLock()
 	has := len(s.flashes) > 0
 	s.mu.RUnlock()
@@ -85,11 +265,24 @@ func (s *Session) HasFlash() bool {
 // Fetching a message deletes it from the session.
 // This means that a message is meant to be displayed only on the first page served to the user.
 func (s *Session) GetFlash(key string) interface{} {
-	fv, ok := s.peekFlashMessage(key)
+	s.loadFlashes(context.Background())
+
+	s.mu.Lock()
+	fv, ok := s.flashes[key]
+	read := ok && !fv.shouldRemove
+	if read {
+		fv.shouldRemove = true
+	}
+	s.mu.Unlock()
+
 	if !ok {
 		return nil
 	}
-	fv.shouldRemove = true
+
+	if read {
+		s.saveFlashes(context.Background())
+	}
+
 	return fv.value
 }
 
@@ -105,6 +298,8 @@ func (s *Session) PeekFlash(key string) interface{} {
 }
 
 func (s *Session) peekFlashMessage(key string) (*flashMessage, bool) {
+	s.loadFlashes(context.Background())
+
 	s.mu.RLock()
 	fv, found := s.flashes[key]
 	s.mu.RUnlock()
@@ -193,9 +388,17 @@ func (s *Session) GetIntDefault(key string, defaultValue int) int {
 // If value doesn't exist on that "key" then it creates one with the "n" as its value.
 // It returns the new, incremented, value.
 func (s *Session) Increment(key string, n int) (newValue int) {
-	newValue = s.GetIntDefault(key, 0)
-	newValue += n
-	s.Set(key, newValue)
+	newValue, _ = s.IncrementE(context.Background(), key, n)
+	return
+}
+
+// IncrementE same as `Increment` but it returns any error coming from the registered database,
+// the value is changed in a single transaction, see `Update`.
+func (s *Session) IncrementE(ctx context.Context, key string, n int) (newValue int, err error) {
+	err = s.UpdateContext(ctx, func(tx *SessionTx) (err error) {
+		newValue, err = tx.Increment(key, n)
+		return
+	})
 	return
 }
 
@@ -203,12 +406,16 @@ func (s *Session) Increment(key string, n int) (newValue int) {
 // If value doesn't exist on that "key" then it creates one with the "n" as its value.
 // It returns the new, decremented, value even if it's less than zero.
 func (s *Session) Decrement(key string, n int) (newValue int) {
-	newValue = s.GetIntDefault(key, 0)
-	newValue -= n
-	s.Set(key, newValue)
+	newValue, _ = s.DecrementE(context.Background(), key, n)
 	return
 }
 
+// DecrementE same as `Decrement` but it returns any error coming from the registered database,
+// the value is changed in a single transaction, see `Update`.
+func (s *Session) DecrementE(ctx context.Context, key string, n int) (int, error) {
+	return s.IncrementE(ctx, key, -n)
+}
+
 // GetInt64 same as `Get` but returns its int64 representation,
 // if key doesn't exist then it returns -1 and a non-nil error.
 func (s *Session) GetInt64(key string) (int64, error) {
@@ -361,44 +568,78 @@ func (s *Session) GetBooleanDefault(key string, defaultValue bool) bool {
 
 // GetAll returns a copy of all session's values.
 func (s *Session) GetAll() map[string]interface{} {
-	items := make(map[string]interface{}, s.provider.db.Len(s.sid))
+	items, _ := s.GetAllE(context.Background())
+	return items
+}
+
+// GetAllE returns a copy of all session's values
+// or any error coming from the registered database.
+func (s *Session) GetAllE(ctx context.Context) (map[string]interface{}, error) {
+	items := make(map[string]interface{})
 	s.mu.RLock()
-	s.provider.db.Visit(s.sid, func(key string, value interface{}) {
+	err := s.VisitE(ctx, func(key string, value interface{}) {
 		items[key] = value
 	})
 	s.mu.RUnlock()
-	return items
+	return items, err
 }
 
 // GetFlashes returns all flash messages as map[string](key) and interface{} value
 // NOTE: this will cause at remove all current flash messages on the next request of the same user.
 func (s *Session) GetFlashes() map[string]interface{} {
-	flashes := make(map[string]interface{}, len(s.flashes))
+	s.loadFlashes(context.Background())
+
 	s.mu.Lock()
+	flashes := make(map[string]interface{}, len(s.flashes))
 	for key, v := range s.flashes {
 		flashes[key] = v.value
 		v.shouldRemove = true
 	}
 	s.mu.Unlock()
+
+	if len(flashes) > 0 {
+		s.saveFlashes(context.Background())
+	}
+
 	return flashes
 }
 
 // Visit loops each of the entries and calls the callback function func(key, value).
 func (s *Session) Visit(cb func(k string, v interface{})) {
-	s.provider.db.Visit(s.sid, cb)
+	s.VisitE(context.Background(), cb)
+}
+
+// VisitE same as `Visit` but it returns any error coming from the registered database.
+func (s *Session) VisitE(ctx context.Context, cb func(k string, v interface{})) error {
+	return s.database().VisitContext(ctx, s.ID(), func(key string, value interface{}) {
+		if !isReservedKey(key) {
+			cb(key, value)
+		}
+	})
 }
 
-func (s *Session) set(key string, value interface{}, immutable bool) {
-	s.provider.db.Set(s.sid, s.Lifetime, key, value, immutable)
+func (s *Session) set(ctx context.Context, key string, value interface{}, immutable bool) error {
+	s.persist(ctx)
+	if err := s.database().SetContext(ctx, s.ID(), s.lifetime(), key, value, immutable); err != nil {
+		return err
+	}
 
 	s.mu.Lock()
 	s.isNew = false
 	s.mu.Unlock()
+
+	s.provider.hooks.fireSet(s, key, value)
+	return nil
 }
 
 // Set fills the session with an entry "value", based on its "key".
 func (s *Session) Set(key string, value interface{}) {
-	s.set(key, value, false)
+	s.set(context.Background(), key, value, false)
+}
+
+// SetE same as `Set` but it returns any error coming from the registered database.
+func (s *Session) SetE(ctx context.Context, key string, value interface{}) error {
+	return s.set(ctx, key, value, false)
 }
 
 // SetImmutable fills the session with an entry "value", based on its "key".
@@ -408,7 +649,12 @@ func (s *Session) Set(key string, value interface{}) {
 // Use it consistently, it's far slower than `Set`.
 // Read more about muttable and immutable go types: https://stackoverflow.com/a/8021081
 func (s *Session) SetImmutable(key string, value interface{}) {
-	s.set(key, value, true)
+	s.set(context.Background(), key, value, true)
+}
+
+// SetImmutableE same as `SetImmutable` but it returns any error coming from the registered database.
+func (s *Session) SetImmutableE(ctx context.Context, key string, value interface{}) error {
+	return s.set(ctx, key, value, true)
 }
 
 // SetFlash sets a flash message by its key.
@@ -431,45 +677,115 @@ func (s *Session) SetImmutable(key string, value interface{}) {
 //
 // In this example we used the key 'success'.
 // If you want to define more than one flash messages, you will have to use different keys.
+//
+// Flash messages are stored through the registered database, so they are available
+// to all instances of the application and they survive a restart.
 func (s *Session) SetFlash(key string, value interface{}) {
+	s.persist(context.Background())
+	s.loadFlashes(context.Background())
+
 	s.mu.Lock()
 	s.flashes[key] = &flashMessage{value: value}
 	s.mu.Unlock()
+
+	s.saveFlashes(context.Background())
 }
 
 // Delete removes an entry by its key,
 // returns true if actually something was removed.
 func (s *Session) Delete(key string) bool {
-	removed := s.provider.db.Delete(s.sid, key)
+	removed, _ := s.DeleteE(context.Background(), key)
+	return removed
+}
+
+// DeleteE same as `Delete` but it returns any error coming from the registered database.
+func (s *Session) DeleteE(ctx context.Context, key string) (bool, error) {
+	removed, err := s.database().DeleteContext(ctx, s.ID(), key)
 	if removed {
 		s.mu.Lock()
 		s.isNew = false
 		s.mu.Unlock()
+
+		s.provider.hooks.fireDelete(s, key)
 	}
 
-	return removed
+	return removed, err
 }
 
 // DeleteFlash removes a flash message by its key.
 func (s *Session) DeleteFlash(key string) {
+	s.loadFlashes(context.Background())
+
 	s.mu.Lock()
+	_, found := s.flashes[key]
 	delete(s.flashes, key)
 	s.mu.Unlock()
+
+	if found {
+		s.saveFlashes(context.Background())
+	}
 }
 
 // Clear removes all entries.
 func (s *Session) Clear() {
+	s.ClearE(context.Background())
+}
+
+// ClearE same as `Clear` but it returns any error coming from the registered database.
+func (s *Session) ClearE(ctx context.Context) error {
+	var keys []string
+	if len(s.provider.hooks.delete) > 0 {
+		s.VisitE(ctx, func(key string, _ interface{}) {
+			keys = append(keys, key)
+		})
+	}
+
+	// the owner and the fingerprint bindings and the flash messages survive the clear.
+	s.loadFlashes(ctx)
+	var bindings Store
+	for _, key := range []string{ownerKey, fingerprintKey} {
+		if v, err := s.database().GetContext(ctx, s.ID(), key); err == nil {
+			bindings.Save(key, v, false)
+		}
+	}
+
 	s.mu.Lock()
-	s.provider.db.Clear(s.sid)
-	s.isNew = false
+	err := s.database().ClearContext(ctx, s.ID())
+	if err == nil {
+		s.isNew = false
+	}
 	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		s.provider.hooks.fireDelete(s, key)
+	}
+
+	// the reserved keys are not session values, restore them.
+	s.saveFlashes(ctx)
+	for _, entry := range bindings {
+		if err = s.database().SetContext(ctx, s.ID(), s.lifetime(), entry.Key, entry.ValueRaw, false); err != nil {
+			return err
+		}
+	}
+
+	return s.provider.saveCreated(ctx, s)
 }
 
 // ClearFlashes removes all flash messages.
 func (s *Session) ClearFlashes() {
+	s.loadFlashes(context.Background())
+
 	s.mu.Lock()
+	n := len(s.flashes)
 	for key := range s.flashes {
 		delete(s.flashes, key)
 	}
 	s.mu.Unlock()
+
+	if n > 0 {
+		s.saveFlashes(context.Background())
+	}
 }
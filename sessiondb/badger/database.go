@@ -2,6 +2,8 @@ package badger
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
 	"log"
 	"os"
@@ -30,7 +32,14 @@ type Database struct {
 	closed uint32 // if 1 is closed.
 }
 
-var _ sessions.Database = (*Database)(nil)
+var (
+	_ sessions.Database        = (*Database)(nil)
+	_ sessions.DatabaseContext = (*Database)(nil)
+	_ sessions.Exister         = (*Database)(nil)
+	_ sessions.Transactional   = (*Database)(nil)
+	_ sessions.Locker          = (*Database)(nil)
+	_ sessions.Iterator        = (*Database)(nil)
+)
 
 // New creates and returns a new badger(key-value file-based) storage
 // instance based on the "directoryPath".
@@ -75,35 +84,124 @@ func NewFromDB(service *badger.DB) *Database {
 // Acquire receives a session's lifetime from the database,
 // if the return value is LifeTime{} then the session manager sets the life time based on the expiration duration lives in configuration.
 func (db *Database) Acquire(sid string, expires time.Duration) sessions.LifeTime {
+	lifetime, err := db.AcquireContext(context.Background(), sid, expires)
+	if err != nil {
+		return sessions.LifeTime{Time: sessions.CookieExpireDelete}
+	}
+
+	return lifetime
+}
+
+// AcquireContext same as `Acquire` but it accepts a context and it returns any badger error.
+func (db *Database) AcquireContext(ctx context.Context, sid string, expires time.Duration) (sessions.LifeTime, error) {
+	if err := ctx.Err(); err != nil {
+		return sessions.LifeTime{}, err
+	}
+
 	txn := db.Service.NewTransaction(true)
-	defer txn.Commit()
+	defer txn.Discard()
 
 	bsid := makePrefix(sid)
 	item, err := txn.Get(bsid)
 	if err == nil {
 		// found, return the expiration.
-		return sessions.LifeTime{Time: time.Unix(int64(item.ExpiresAt()), 0)}
+		if expiresAt := item.ExpiresAt(); expiresAt > 0 {
+			return sessions.LifeTime{Time: time.Unix(int64(expiresAt), 0)}, nil
+		}
+
+		return sessions.LifeTime{}, nil
+	}
+
+	if err != badger.ErrKeyNotFound {
+		return sessions.LifeTime{}, err
 	}
 
 	// not found, create an entry with ttl and return an empty lifetime, session manager will do its job.
-	if err != nil {
-		if err == badger.ErrKeyNotFound {
-			// create it and set the expiration, we don't care about the value there.
-			err = txn.SetEntry(badger.NewEntry(bsid, bsid).WithTTL(expires))
-		}
+	// create it and set the expiration, we don't care about the value there.
+	entry := badger.NewEntry(bsid, bsid)
+	if expires > 0 {
+		entry = entry.WithTTL(expires)
 	}
 
-	if err != nil {
-		return sessions.LifeTime{Time: sessions.CookieExpireDelete}
+	if err = txn.SetEntry(entry); err != nil {
+		return sessions.LifeTime{}, err
+	}
+
+	if err = txn.Commit(); err != nil {
+		return sessions.LifeTime{}, err
+	}
+
+	return sessions.LifeTime{}, nil // session manager will handle the rest.
+}
+
+// Exists reports whether a session entry with the given "sid" exists, see `sessions.Config.Strict`.
+func (db *Database) Exists(ctx context.Context, sid string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	txn := db.Service.NewTransaction(false)
+	defer txn.Discard()
+
+	_, err := txn.Get(makePrefix(sid))
+	if err == badger.ErrKeyNotFound {
+		return false, nil
 	}
 
-	return sessions.LifeTime{} // session manager will handle the rest.
+	return err == nil, err
 }
 
-// OnUpdateExpiration not implemented here, yet.
-// Note that this error will not be logged, callers should catch it manually.
+// OnUpdateExpiration will re-set the ttl of the session's entry and its values.
 func (db *Database) OnUpdateExpiration(sid string, newExpires time.Duration) error {
-	return sessions.ErrNotImplemented
+	return db.OnUpdateExpirationContext(context.Background(), sid, newExpires)
+}
+
+// OnUpdateExpirationContext same as `OnUpdateExpiration` but it accepts a context.
+// Badger can not change the ttl of an entry, so the entries are rewritten with the new one,
+// in a single transaction. It returns a `sessions.ErrNotFound` if the session's entry does not exist.
+func (db *Database) OnUpdateExpirationContext(ctx context.Context, sid string, newExpires time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	prefix := makePrefix(sid)
+
+	return db.Service.Update(func(txn *badger.Txn) error {
+		if _, err := txn.Get(prefix); err != nil {
+			if err == badger.ErrKeyNotFound {
+				return sessions.ErrNotFound
+			}
+
+			return err
+		}
+
+		// collect the entries first, they are rewritten after the iteration.
+		var entries []*badger.Entry
+		iter := txn.NewIterator(badger.DefaultIteratorOptions)
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			item := iter.Item()
+			value, err := item.ValueCopy(nil)
+			if err != nil {
+				iter.Close()
+				return err
+			}
+
+			entries = append(entries, badger.NewEntry(item.KeyCopy(nil), value))
+		}
+		iter.Close()
+
+		for _, entry := range entries {
+			if newExpires > 0 {
+				entry = entry.WithTTL(newExpires)
+			}
+
+			if err := txn.SetEntry(entry); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 var delim = byte('_')
@@ -119,20 +217,43 @@ func makeKey(sid, key string) []byte {
 // Set sets a key value of a specific session.
 // Ignore the "immutable".
 func (db *Database) Set(sid string, lifetime sessions.LifeTime, key string, value interface{}, immutable bool) {
+	db.SetContext(context.Background(), sid, lifetime, key, value, immutable)
+}
+
+// SetContext same as `Set` but it accepts a context and it returns any encoding or badger error.
+func (db *Database) SetContext(ctx context.Context, sid string, lifetime sessions.LifeTime, key string, value interface{}, immutable bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	valueBytes, err := sessions.DefaultTranscoder.Marshal(value)
 	if err != nil {
-		return
+		return err
 	}
 
-	db.Service.Update(func(txn *badger.Txn) error {
-		dur := lifetime.DurationUntilExpiration()
-		return txn.SetEntry(badger.NewEntry(makeKey(sid, key), valueBytes).WithTTL(dur))
+	return db.Service.Update(func(txn *badger.Txn) error {
+		entry := badger.NewEntry(makeKey(sid, key), valueBytes)
+		if !lifetime.IsZero() {
+			entry = entry.WithTTL(lifetime.DurationUntilExpiration())
+		}
+		return txn.SetEntry(entry)
 	})
 }
 
 // Get retrieves a session value based on the key.
 func (db *Database) Get(sid string, key string) (value interface{}) {
-	err := db.Service.View(func(txn *badger.Txn) error {
+	value, _ = db.GetContext(context.Background(), sid, key)
+	return
+}
+
+// GetContext same as `Get` but it accepts a context and it returns
+// a `sessions.ErrNotFound` if the key does not exist or any decoding or badger error.
+func (db *Database) GetContext(ctx context.Context, sid string, key string) (value interface{}, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	err = db.Service.View(func(txn *badger.Txn) error {
 		item, err := txn.Get(makeKey(sid, key))
 		if err != nil {
 			return err
@@ -143,8 +264,8 @@ func (db *Database) Get(sid string, key string) (value interface{}) {
 		})
 	})
 
-	if err != nil && err != badger.ErrKeyNotFound {
-		return nil
+	if err == badger.ErrKeyNotFound {
+		return nil, sessions.ErrNotFound
 	}
 
 	return
@@ -158,6 +279,15 @@ func validSessionItem(key, prefix []byte) bool {
 
 // Visit loops through all session keys and values.
 func (db *Database) Visit(sid string, cb func(key string, value interface{})) {
+	db.VisitContext(context.Background(), sid, cb)
+}
+
+// VisitContext same as `Visit` but it accepts a context and it returns any decoding or badger error.
+func (db *Database) VisitContext(ctx context.Context, sid string, cb func(key string, value interface{})) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	prefix := makePrefix(sid)
 
 	txn := db.Service.NewTransaction(false)
@@ -166,11 +296,7 @@ func (db *Database) Visit(sid string, cb func(key string, value interface{})) {
 	iter := txn.NewIterator(badger.DefaultIteratorOptions)
 	defer iter.Close()
 
-	for iter.Rewind(); ; iter.Next() {
-		if !iter.Valid() {
-			break
-		}
-
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
 		item := iter.Item()
 		key := item.Key()
 		if !validSessionItem(key, prefix) {
@@ -184,11 +310,13 @@ func (db *Database) Visit(sid string, cb func(key string, value interface{})) {
 		})
 
 		if err != nil {
-			continue
+			return err
 		}
 
 		cb(string(bytes.TrimPrefix(key, prefix)), value)
 	}
+
+	return nil
 }
 
 var iterOptionsNoValues = badger.IteratorOptions{
@@ -200,13 +328,25 @@ var iterOptionsNoValues = badger.IteratorOptions{
 
 // Len returns the length of the session's entries (keys).
 func (db *Database) Len(sid string) (n int) {
+	n, _ = db.LenContext(context.Background(), sid)
+	return
+}
+
+// LenContext same as `Len` but it accepts a context.
+func (db *Database) LenContext(ctx context.Context, sid string) (n int, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	prefix := makePrefix(sid)
 
 	txn := db.Service.NewTransaction(false)
 	iter := txn.NewIterator(iterOptionsNoValues)
 
-	for iter.Rewind(); iter.ValidForPrefix(prefix); iter.Next() {
-		n++
+	for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+		if validSessionItem(iter.Item().Key(), prefix) {
+			n++
+		}
 	}
 
 	iter.Close()
@@ -216,39 +356,299 @@ func (db *Database) Len(sid string) (n int) {
 
 // Delete removes a session key value based on its key.
 func (db *Database) Delete(sid string, key string) (deleted bool) {
-	txn := db.Service.NewTransaction(true)
-	err := txn.Delete(makeKey(sid, key))
+	deleted, _ = db.DeleteContext(context.Background(), sid, key)
+	return
+}
+
+// DeleteContext same as `Delete` but it accepts a context and it returns any badger error.
+func (db *Database) DeleteContext(ctx context.Context, sid string, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	err := db.Service.Update(func(txn *badger.Txn) error {
+		return txn.Delete(makeKey(sid, key))
+	})
+
+	return err == nil, err
+}
+
+// MaxTxRetries is the maximum number of attempts of a transaction
+// which conflicts with a concurrent one, see `Database.UpdateContext`.
+var MaxTxRetries = 10
+
+// UpdateContext runs the "fn" in a read-write badger transaction,
+// see the `sessions.Transactional` interface.
+// The "fn" is called again, up to `MaxTxRetries` times, if the transaction conflicts with a concurrent one.
+func (db *Database) UpdateContext(ctx context.Context, sid string, lifetime sessions.LifeTime, fn func(tx sessions.Tx) error) (err error) {
+	for i := 0; i < MaxTxRetries; i++ {
+		if err = ctx.Err(); err != nil {
+			return
+		}
+
+		err = db.Service.Update(func(txn *badger.Txn) error {
+			return fn(&sessionTx{txn: txn, sid: sid, lifetime: lifetime})
+		})
+
+		if err != badger.ErrConflict {
+			return
+		}
+	}
+
+	return
+}
+
+// sessionTx adapts a badger transaction to a `sessions.Tx`.
+type sessionTx struct {
+	txn      *badger.Txn
+	sid      string
+	lifetime sessions.LifeTime
+}
+
+func (t *sessionTx) Get(key string) (value interface{}, err error) {
+	item, err := t.txn.Get(makeKey(t.sid, key))
 	if err != nil {
-		return
+		if err == badger.ErrKeyNotFound {
+			return nil, sessions.ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	err = item.Value(func(valueBytes []byte) error {
+		return sessions.DefaultTranscoder.Unmarshal(valueBytes, &value)
+	})
+	return
+}
+
+func (t *sessionTx) Set(key string, value interface{}) error {
+	valueBytes, err := sessions.DefaultTranscoder.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	entry := badger.NewEntry(makeKey(t.sid, key), valueBytes)
+	if !t.lifetime.IsZero() {
+		entry = entry.WithTTL(t.lifetime.DurationUntilExpiration())
+	}
+	return t.txn.SetEntry(entry)
+}
+
+func (t *sessionTx) Delete(key string) (bool, error) {
+	if _, err := t.txn.Get(makeKey(t.sid, key)); err != nil {
+		if err == badger.ErrKeyNotFound {
+			return false, nil
+		}
+
+		return false, err
 	}
-	txn.Commit()
-	return err == nil
+
+	return true, t.txn.Delete(makeKey(t.sid, key))
 }
 
 // Clear removes all session key values but it keeps the session entry.
 func (db *Database) Clear(sid string) {
+	db.ClearContext(context.Background(), sid)
+}
+
+// ClearContext same as `Clear` but it accepts a context and it returns any badger error.
+func (db *Database) ClearContext(ctx context.Context, sid string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	prefix := makePrefix(sid)
 
-	txn := db.Service.NewTransaction(true)
-	defer txn.Commit()
+	return db.Service.Update(func(txn *badger.Txn) error {
+		iter := txn.NewIterator(iterOptionsNoValues)
+		defer iter.Close()
 
-	iter := txn.NewIterator(iterOptionsNoValues)
-	defer iter.Close()
+		for iter.Seek(prefix); iter.ValidForPrefix(prefix); iter.Next() {
+			key := iter.Item().KeyCopy(nil)
+			if !validSessionItem(key, prefix) {
+				continue // keep the session entry itself.
+			}
 
-	for iter.Rewind(); iter.ValidForPrefix(prefix); iter.Next() {
-		txn.Delete(iter.Item().Key())
-	}
+			if err := txn.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 }
 
 // Release destroys the session, it clears and removes the session entry,
 // session manager will create a new session ID on the next request after this call.
 func (db *Database) Release(sid string) {
+	db.ReleaseContext(context.Background(), sid)
+}
+
+// ReleaseContext same as `Release` but it accepts a context and it returns any badger error.
+func (db *Database) ReleaseContext(ctx context.Context, sid string) error {
 	// clear all $sid-$key.
-	db.Clear(sid)
+	if err := db.ClearContext(ctx, sid); err != nil {
+		return err
+	}
+
 	// and remove the $sid.
-	txn := db.Service.NewTransaction(true)
-	txn.Delete([]byte(sid))
-	txn.Commit()
+	return db.Service.Update(func(txn *badger.Txn) error {
+		return txn.Delete(makePrefix(sid))
+	})
+}
+
+// IterateContext calls the "cb" for each stored session id, see the `sessions.Iterator` interface.
+// The session entries are the keys that end with the delimiter and store their own key, see `AcquireContext`,
+// so the ids which contain the delimiter are listed too.
+func (db *Database) IterateContext(ctx context.Context, cb func(sid string) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return db.Service.View(func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.PrefetchValues = false
+		iter := txn.NewIterator(opts)
+		defer iter.Close()
+
+		for iter.Rewind(); iter.Valid(); iter.Next() {
+			item := iter.Item()
+			key := item.Key()
+			if len(key) < 2 || key[len(key)-1] != delim { // a session's value or a lock.
+				continue
+			}
+
+			isEntry := false
+			err := item.Value(func(value []byte) error {
+				isEntry = bytes.Equal(value, key)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			if !isEntry { // a session's value with a key that ends with the delimiter.
+				continue
+			}
+
+			if !cb(string(key[:len(key)-1])) {
+				break
+			}
+		}
+
+		return nil
+	})
+}
+
+// LockRetryInterval is the interval between the attempts of the `LockContext` to acquire a held lock.
+var LockRetryInterval = 50 * time.Millisecond
+
+// the lock keys are not prefixed by a session id, so they are not part of any session.
+var (
+	lockKeyPrefix = []byte("$locks_")
+	fenceKey      = []byte("$locks")
+)
+
+// LockContext acquires the lock of the session "sid" through a badger transaction,
+// the lock's entry expires after the "lease", see the `sessions.Locker` interface.
+func (db *Database) LockContext(ctx context.Context, sid string, lease time.Duration) (uint64, error) {
+	lockKey := append(append([]byte{}, lockKeyPrefix...), sid...)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		var token uint64
+		err := db.Service.Update(func(txn *badger.Txn) error {
+			if _, err := txn.Get(lockKey); err != badger.ErrKeyNotFound {
+				return err // held (nil error) or a badger error.
+			}
+
+			var fence uint64
+			item, err := txn.Get(fenceKey)
+			if err == nil {
+				err = item.Value(func(val []byte) error {
+					if len(val) == 8 {
+						fence = binary.BigEndian.Uint64(val)
+					}
+					return nil
+				})
+			}
+
+			if err != nil && err != badger.ErrKeyNotFound {
+				return err
+			}
+
+			fence++
+			value := make([]byte, 8)
+			binary.BigEndian.PutUint64(value, fence)
+			if err = txn.Set(fenceKey, value); err != nil {
+				return err
+			}
+
+			if err = txn.SetEntry(badger.NewEntry(lockKey, value).WithTTL(lease)); err != nil {
+				return err
+			}
+
+			token = fence
+			return nil
+		})
+
+		if err == badger.ErrConflict {
+			continue
+		}
+
+		if err != nil {
+			return 0, err
+		}
+
+		if token > 0 {
+			return token, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(LockRetryInterval):
+		}
+	}
+}
+
+// UnlockContext releases the lock of the session "sid" if it's held by the "token",
+// see the `sessions.Locker` interface.
+func (db *Database) UnlockContext(ctx context.Context, sid string, token uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	lockKey := append(append([]byte{}, lockKeyPrefix...), sid...)
+	return db.Service.Update(func(txn *badger.Txn) error {
+		item, err := txn.Get(lockKey)
+		if err != nil {
+			if err == badger.ErrKeyNotFound {
+				return sessions.ErrNotLocked
+			}
+
+			return err
+		}
+
+		var held uint64
+		if err = item.Value(func(val []byte) error {
+			if len(val) == 8 {
+				held = binary.BigEndian.Uint64(val)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+
+		if held != token {
+			return sessions.ErrNotLocked
+		}
+
+		return txn.Delete(lockKey)
+	})
 }
 
 // Close shutdowns the badger connection.
@@ -0,0 +1,142 @@
+package badger
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kataras/go-sessions/v3"
+)
+
+// the badger's time-to-live has a resolution of a second.
+const lease = 2 * time.Second
+
+func newTestDatabase(t *testing.T) *Database {
+	db, err := New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLock(t *testing.T) {
+	db := newTestDatabase(t)
+
+	ctx := context.Background()
+	token, err := db.LockContext(ctx, "sid", lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, lease/4)
+	defer cancel()
+	if _, err = db.LockContext(waitCtx, "sid", lease); err != context.DeadlineExceeded {
+		t.Fatalf("expected the held lock to block until the context is done but got %v", err)
+	}
+
+	if err = db.UnlockContext(ctx, "sid", token+1); err != sessions.ErrNotLocked {
+		t.Fatalf("expected %v for a token of another holder but got %v", sessions.ErrNotLocked, err)
+	}
+
+	if err = db.UnlockContext(ctx, "sid", token); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := db.LockContext(ctx, "sid", lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next <= token {
+		t.Fatalf("expected the fencing token to increase but got %d after %d", next, token)
+	}
+
+	// the lease expires and the lock is acquired by another holder.
+	waitCtx, cancel = context.WithTimeout(ctx, 3*lease)
+	defer cancel()
+	last, err := db.LockContext(waitCtx, "sid", lease)
+	if err != nil {
+		t.Fatalf("expected the lock to be released after its lease but got %v", err)
+	}
+
+	if err = db.UnlockContext(ctx, "sid", next); err != sessions.ErrNotLocked {
+		t.Fatalf("expected %v for an expired holder but got %v", sessions.ErrNotLocked, err)
+	}
+
+	if err = db.UnlockContext(ctx, "sid", last); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateExpiration(t *testing.T) {
+	db := newTestDatabase(t)
+
+	ctx := context.Background()
+	lifetime, err := db.AcquireContext(ctx, "sid", lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lifetime.Time = time.Now().Add(lease)
+
+	if err = db.SetContext(ctx, "sid", lifetime, "name", "go-sessions", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = db.OnUpdateExpirationContext(ctx, "sid", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if lifetime, err = db.AcquireContext(ctx, "sid", lease); err != nil || lifetime.DurationUntilExpiration() <= lease {
+		t.Fatalf("expected the expiration to be moved forward but got %v (%v)", lifetime.Time, err)
+	}
+
+	if v, err := db.GetContext(ctx, "sid", "name"); err != nil || v != "go-sessions" {
+		t.Fatalf("expected the values to be kept but got %v (%v)", v, err)
+	}
+
+	if err = db.OnUpdateExpirationContext(ctx, "unknown", time.Hour); err != sessions.ErrNotFound {
+		t.Fatalf("expected %v for an unknown session but got %v", sessions.ErrNotFound, err)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	db := newTestDatabase(t)
+
+	ctx := context.Background()
+	sids := []string{"sid", "base64url_id"}
+	for _, sid := range sids {
+		if _, err := db.AcquireContext(ctx, sid, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+
+		// a value with a key that ends with the delimiter is not a session entry.
+		if err := db.SetContext(ctx, sid, sessions.LifeTime{}, "key_", "value", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var got []string
+	if err := db.IterateContext(ctx, func(sid string) bool {
+		got = append(got, sid)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(sids) {
+		t.Fatalf("expected the session ids %v but got %v", sids, got)
+	}
+
+	for _, sid := range sids {
+		found := false
+		for _, g := range got {
+			found = found || g == sid
+		}
+
+		if !found {
+			t.Fatalf("expected the session id %q to be listed, got %v", sid, got)
+		}
+	}
+}
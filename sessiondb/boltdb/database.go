@@ -1,6 +1,9 @@
 package boltdb
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"errors"
 	"log"
 	"os"
@@ -23,12 +26,23 @@ var (
 // Database the BoltDB(file-based) session storage.
 type Database struct {
 	table []byte
+	// locks is the bucket of the sessions' locks, see `LockContext`.
+	locks []byte
 	// Service is the underline BoltDB database connection,
 	// it's initialized at `New` or `NewFromDB`.
 	// Can be used to get stats.
 	Service *bolt.DB
 }
 
+var (
+	_ sessions.Database        = (*Database)(nil)
+	_ sessions.DatabaseContext = (*Database)(nil)
+	_ sessions.Exister         = (*Database)(nil)
+	_ sessions.Transactional   = (*Database)(nil)
+	_ sessions.Locker          = (*Database)(nil)
+	_ sessions.Iterator        = (*Database)(nil)
+)
+
 var errPathMissing = errors.New("path is required")
 
 // New creates and returns a new BoltDB(file-based) storage
@@ -64,13 +78,18 @@ func New(path string, fileMode os.FileMode) (*Database, error) {
 // NewFromDB same as `New` but accepts an already-created custom boltdb connection instead.
 func NewFromDB(service *bolt.DB, bucketName string) (*Database, error) {
 	bucket := []byte(bucketName)
+	locks := []byte(bucketName + "_locks")
 
 	service.Update(func(tx *bolt.Tx) (err error) {
-		_, err = tx.CreateBucketIfNotExists(bucket)
+		if _, err = tx.CreateBucketIfNotExists(bucket); err != nil {
+			return
+		}
+
+		_, err = tx.CreateBucketIfNotExists(locks)
 		return
 	})
 
-	db := &Database{table: bucket, Service: service}
+	db := &Database{table: bucket, locks: locks, Service: service}
 
 	runtime.SetFinalizer(db, closeDB)
 	return db, db.cleanup()
@@ -147,9 +166,23 @@ var expirationKey = []byte("exp") // it can be random.
 
 // Acquire receives a session's lifetime from the database,
 // if the return value is LifeTime{} then the session manager sets the life time based on the expiration duration lives in configuration.
-func (db *Database) Acquire(sid string, expires time.Duration) (lifetime sessions.LifeTime) {
+func (db *Database) Acquire(sid string, expires time.Duration) sessions.LifeTime {
+	lifetime, err := db.AcquireContext(context.Background(), sid, expires)
+	if err != nil {
+		return sessions.LifeTime{Time: sessions.CookieExpireDelete}
+	}
+
+	return lifetime
+}
+
+// AcquireContext same as `Acquire` but it accepts a context and it returns any bolt error.
+func (db *Database) AcquireContext(ctx context.Context, sid string, expires time.Duration) (lifetime sessions.LifeTime, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
 	bsid := []byte(sid)
-	err := db.Service.Update(func(tx *bolt.Tx) (err error) {
+	err = db.Service.Update(func(tx *bolt.Tx) (err error) {
 		root := db.getBucket(tx)
 
 		if expires > 0 { // should check or create the expiration bucket.
@@ -197,15 +230,49 @@ func (db *Database) Acquire(sid string, expires time.Duration) (lifetime session
 		return
 	})
 
-	if err != nil {
-		return sessions.LifeTime{Time: sessions.CookieExpireDelete}
+	return
+}
+
+// Exists reports whether a session entry with the given "sid" exists and it's not expired,
+// see `sessions.Config.Strict`.
+func (db *Database) Exists(ctx context.Context, sid string) (exists bool, err error) {
+	if err = ctx.Err(); err != nil {
+		return
 	}
 
+	bsid := []byte(sid)
+	err = db.Service.View(func(tx *bolt.Tx) error {
+		root := db.getBucket(tx)
+		if root.Bucket(bsid) == nil {
+			return nil
+		}
+
+		if b := root.Bucket(getExpirationBucketName(bsid)); b != nil {
+			_, expValue := b.Cursor().First()
+			var expirationTime time.Time
+			if expValue != nil && sessions.DefaultTranscoder.Unmarshal(expValue, &expirationTime) == nil && expirationTime.Before(time.Now()) {
+				return nil // expired, it will be removed on the next cleanup.
+			}
+		}
+
+		exists = true
+		return nil
+	})
+
 	return
 }
 
 // OnUpdateExpiration will re-set the database's session's entry ttl.
 func (db *Database) OnUpdateExpiration(sid string, newExpires time.Duration) error {
+	return db.OnUpdateExpirationContext(context.Background(), sid, newExpires)
+}
+
+// OnUpdateExpirationContext same as `OnUpdateExpiration` but it accepts a context.
+func (db *Database) OnUpdateExpirationContext(ctx context.Context, sid string, newExpires time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	expirationTime := time.Now().Add(newExpires)
 	timeBytes, err := sessions.DefaultTranscoder.Marshal(expirationTime)
 	if err != nil {
@@ -232,15 +299,24 @@ func makeKey(key string) []byte {
 // Set sets a key value of a specific session.
 // Ignore the "immutable".
 func (db *Database) Set(sid string, lifetime sessions.LifeTime, key string, value interface{}, immutable bool) {
+	db.SetContext(context.Background(), sid, lifetime, key, value, immutable)
+}
+
+// SetContext same as `Set` but it accepts a context and it returns any encoding or bolt error.
+func (db *Database) SetContext(ctx context.Context, sid string, lifetime sessions.LifeTime, key string, value interface{}, immutable bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	valueBytes, err := sessions.DefaultTranscoder.Marshal(value)
 	if err != nil {
-		return
+		return err
 	}
 
-	db.Service.Update(func(tx *bolt.Tx) error {
+	return db.Service.Update(func(tx *bolt.Tx) error {
 		b := db.getBucketForSession(tx, sid)
 		if b == nil {
-			return nil
+			return sessions.ErrNotFound
 		}
 
 		// Author's notes:
@@ -253,15 +329,26 @@ func (db *Database) Set(sid string, lifetime sessions.LifeTime, key string, valu
 
 // Get retrieves a session value based on the key.
 func (db *Database) Get(sid string, key string) (value interface{}) {
-	db.Service.View(func(tx *bolt.Tx) error {
+	value, _ = db.GetContext(context.Background(), sid, key)
+	return
+}
+
+// GetContext same as `Get` but it accepts a context and it returns
+// a `sessions.ErrNotFound` if the key does not exist or any decoding or bolt error.
+func (db *Database) GetContext(ctx context.Context, sid string, key string) (value interface{}, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	err = db.Service.View(func(tx *bolt.Tx) error {
 		b := db.getBucketForSession(tx, sid)
 		if b == nil {
-			return nil
+			return sessions.ErrNotFound
 		}
 
 		valueBytes := b.Get(makeKey(key))
 		if len(valueBytes) == 0 {
-			return nil
+			return sessions.ErrNotFound
 		}
 
 		return sessions.DefaultTranscoder.Unmarshal(valueBytes, &value)
@@ -272,7 +359,16 @@ func (db *Database) Get(sid string, key string) (value interface{}) {
 
 // Visit loops through all session keys and values.
 func (db *Database) Visit(sid string, cb func(key string, value interface{})) {
-	db.Service.View(func(tx *bolt.Tx) error {
+	db.VisitContext(context.Background(), sid, cb)
+}
+
+// VisitContext same as `Visit` but it accepts a context and it returns any decoding or bolt error.
+func (db *Database) VisitContext(ctx context.Context, sid string, cb func(key string, value interface{})) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return db.Service.View(func(tx *bolt.Tx) error {
 		b := db.getBucketForSession(tx, sid)
 		if b == nil {
 			return nil
@@ -292,7 +388,17 @@ func (db *Database) Visit(sid string, cb func(key string, value interface{})) {
 
 // Len returns the length of the session's entries (keys).
 func (db *Database) Len(sid string) (n int) {
-	db.Service.View(func(tx *bolt.Tx) error {
+	n, _ = db.LenContext(context.Background(), sid)
+	return
+}
+
+// LenContext same as `Len` but it accepts a context and it returns any bolt error.
+func (db *Database) LenContext(ctx context.Context, sid string) (n int, err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+
+	err = db.Service.View(func(tx *bolt.Tx) error {
 		b := db.getBucketForSession(tx, sid)
 		if b == nil {
 			return nil
@@ -307,6 +413,16 @@ func (db *Database) Len(sid string) (n int) {
 
 // Delete removes a session key value based on its key.
 func (db *Database) Delete(sid string, key string) (deleted bool) {
+	deleted, _ = db.DeleteContext(context.Background(), sid, key)
+	return
+}
+
+// DeleteContext same as `Delete` but it accepts a context and it returns any bolt error.
+func (db *Database) DeleteContext(ctx context.Context, sid string, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
 	err := db.Service.Update(func(tx *bolt.Tx) error {
 		b := db.getBucketForSession(tx, sid)
 		if b == nil {
@@ -316,12 +432,70 @@ func (db *Database) Delete(sid string, key string) (deleted bool) {
 		return b.Delete(makeKey(key))
 	})
 
-	return err == nil
+	return err == nil, err
+}
+
+// UpdateContext runs the "fn" in a read-write bolt transaction,
+// see the `sessions.Transactional` interface.
+func (db *Database) UpdateContext(ctx context.Context, sid string, lifetime sessions.LifeTime, fn func(tx sessions.Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return db.Service.Update(func(tx *bolt.Tx) error {
+		b := db.getBucketForSession(tx, sid)
+		if b == nil {
+			return sessions.ErrNotFound
+		}
+
+		return fn(&sessionTx{b: b})
+	})
+}
+
+// sessionTx adapts a session's bucket of a bolt transaction to a `sessions.Tx`.
+type sessionTx struct {
+	b *bolt.Bucket
+}
+
+func (t *sessionTx) Get(key string) (value interface{}, err error) {
+	valueBytes := t.b.Get(makeKey(key))
+	if len(valueBytes) == 0 {
+		return nil, sessions.ErrNotFound
+	}
+
+	err = sessions.DefaultTranscoder.Unmarshal(valueBytes, &value)
+	return
+}
+
+func (t *sessionTx) Set(key string, value interface{}) error {
+	valueBytes, err := sessions.DefaultTranscoder.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	return t.b.Put(makeKey(key), valueBytes)
+}
+
+func (t *sessionTx) Delete(key string) (bool, error) {
+	if len(t.b.Get(makeKey(key))) == 0 {
+		return false, nil
+	}
+
+	return true, t.b.Delete(makeKey(key))
 }
 
 // Clear removes all session key values but it keeps the session entry.
 func (db *Database) Clear(sid string) {
-	db.Service.Update(func(tx *bolt.Tx) error {
+	db.ClearContext(context.Background(), sid)
+}
+
+// ClearContext same as `Clear` but it accepts a context and it returns any bolt error.
+func (db *Database) ClearContext(ctx context.Context, sid string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return db.Service.Update(func(tx *bolt.Tx) error {
 		b := db.getBucketForSession(tx, sid)
 		if b == nil {
 			return nil
@@ -336,14 +510,23 @@ func (db *Database) Clear(sid string) {
 // Release destroys the session, it clears and removes the session entry,
 // session manager will create a new session ID on the next request after this call.
 func (db *Database) Release(sid string) {
-	db.Service.Update(func(tx *bolt.Tx) error {
+	db.ReleaseContext(context.Background(), sid)
+}
+
+// ReleaseContext same as `Release` but it accepts a context and it returns any bolt error.
+func (db *Database) ReleaseContext(ctx context.Context, sid string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return db.Service.Update(func(tx *bolt.Tx) error {
 		// delete the session bucket.
 		b := db.getBucket(tx)
 		bsid := []byte(sid)
 		// try to delete the associated expiration bucket, if exists, ignore error.
 		b.DeleteBucket(getExpirationBucketName(bsid))
 
-		if err := b.DeleteBucket(bsid); err != nil {
+		if err := b.DeleteBucket(bsid); err != nil && err != bolt.ErrBucketNotFound {
 			return err
 		}
 
@@ -351,6 +534,100 @@ func (db *Database) Release(sid string) {
 	})
 }
 
+// IterateContext calls the "cb" for each stored session id, through a cursor of the sessions bucket,
+// see the `sessions.Iterator` interface.
+func (db *Database) IterateContext(ctx context.Context, cb func(sid string) bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	expirationSuffix := append(delim, expirationBucketName...)
+	return db.Service.View(func(tx *bolt.Tx) error {
+		c := db.getBucket(tx).Cursor()
+		// each session has its own bucket and its expiration bucket, if any.
+		for bsid, v := c.First(); bsid != nil; bsid, v = c.Next() {
+			if v != nil || len(bsid) == 0 || bytes.HasSuffix(bsid, expirationSuffix) {
+				continue
+			}
+
+			if !cb(string(bsid)) {
+				break
+			}
+		}
+
+		return nil
+	})
+}
+
+// LockRetryInterval is the interval between the attempts of the `LockContext` to acquire a held lock.
+var LockRetryInterval = 50 * time.Millisecond
+
+// LockContext acquires the lock of the session "sid" through a bolt transaction,
+// the fencing token is the sequence of the locks bucket, see the `sessions.Locker` interface.
+func (db *Database) LockContext(ctx context.Context, sid string, lease time.Duration) (uint64, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+
+		var token uint64
+		err := db.Service.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket(db.locks)
+			if lock := b.Get([]byte(sid)); len(lock) == 16 &&
+				time.Now().UnixNano() < int64(binary.BigEndian.Uint64(lock[8:])) {
+				return nil // held and its lease has not expired yet.
+			}
+
+			seq, err := b.NextSequence()
+			if err != nil {
+				return err
+			}
+
+			lock := make([]byte, 16)
+			binary.BigEndian.PutUint64(lock, seq)
+			binary.BigEndian.PutUint64(lock[8:], uint64(time.Now().Add(lease).UnixNano()))
+			if err = b.Put([]byte(sid), lock); err != nil {
+				return err
+			}
+
+			token = seq
+			return nil
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		if token > 0 {
+			return token, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(LockRetryInterval):
+		}
+	}
+}
+
+// UnlockContext releases the lock of the session "sid" if it's held by the "token",
+// see the `sessions.Locker` interface.
+func (db *Database) UnlockContext(ctx context.Context, sid string, token uint64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return db.Service.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(db.locks)
+		lock := b.Get([]byte(sid))
+		if len(lock) != 16 || binary.BigEndian.Uint64(lock) != token ||
+			time.Now().UnixNano() >= int64(binary.BigEndian.Uint64(lock[8:])) {
+			return sessions.ErrNotLocked
+		}
+
+		return b.Delete([]byte(sid))
+	})
+}
+
 // Close shutdowns the BoltDB connection.
 func (db *Database) Close() error {
 	return closeDB(db)
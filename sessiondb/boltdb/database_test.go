@@ -0,0 +1,71 @@
+package boltdb
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kataras/go-sessions/v3"
+)
+
+const lease = 200 * time.Millisecond
+
+func newTestDatabase(t *testing.T) *Database {
+	db, err := New(filepath.Join(t.TempDir(), "sessions.db"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLock(t *testing.T) {
+	db := newTestDatabase(t)
+
+	ctx := context.Background()
+	token, err := db.LockContext(ctx, "sid", lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, lease/4)
+	defer cancel()
+	if _, err = db.LockContext(waitCtx, "sid", lease); err != context.DeadlineExceeded {
+		t.Fatalf("expected the held lock to block until the context is done but got %v", err)
+	}
+
+	if err = db.UnlockContext(ctx, "sid", token+1); err != sessions.ErrNotLocked {
+		t.Fatalf("expected %v for a token of another holder but got %v", sessions.ErrNotLocked, err)
+	}
+
+	if err = db.UnlockContext(ctx, "sid", token); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := db.LockContext(ctx, "sid", lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next <= token {
+		t.Fatalf("expected the fencing token to increase but got %d after %d", next, token)
+	}
+
+	// the lease expires and the lock is acquired by another holder.
+	waitCtx, cancel = context.WithTimeout(ctx, 3*lease)
+	defer cancel()
+	last, err := db.LockContext(waitCtx, "sid", lease)
+	if err != nil {
+		t.Fatalf("expected the lock to be released after its lease but got %v", err)
+	}
+
+	if err = db.UnlockContext(ctx, "sid", next); err != sessions.ErrNotLocked {
+		t.Fatalf("expected %v for an expired holder but got %v", sessions.ErrNotLocked, err)
+	}
+
+	if err = db.UnlockContext(ctx, "sid", last); err != nil {
+		t.Fatal(err)
+	}
+}
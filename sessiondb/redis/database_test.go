@@ -0,0 +1,123 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kataras/go-sessions/v3"
+	"github.com/kataras/go-sessions/v3/sessiondb/redis/service"
+)
+
+const lease = 200 * time.Millisecond
+
+// newTestDatabase connects to the redis server of the service.DefaultConfig,
+// the test is skipped if it's not running.
+func newTestDatabase(t *testing.T) *Database {
+	cfg := service.DefaultConfig()
+	cfg.Prefix = "go-sessions-test-" + time.Now().Format("150405.000000") + "-"
+
+	db := &Database{redis: service.New(cfg)}
+	db.redis.Connect()
+	if ok, err := db.redis.PingPong(); !ok || err != nil {
+		t.Skipf("redis is not available: %v", err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestLock(t *testing.T) {
+	db := newTestDatabase(t)
+
+	ctx := context.Background()
+	token, err := db.LockContext(ctx, "sid", lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, lease/4)
+	defer cancel()
+	if _, err = db.LockContext(waitCtx, "sid", lease); err != context.DeadlineExceeded {
+		t.Fatalf("expected the held lock to block until the context is done but got %v", err)
+	}
+
+	if err = db.UnlockContext(ctx, "sid", token+1); err != sessions.ErrNotLocked {
+		t.Fatalf("expected %v for a token of another holder but got %v", sessions.ErrNotLocked, err)
+	}
+
+	if err = db.UnlockContext(ctx, "sid", token); err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := db.LockContext(ctx, "sid", lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next <= token {
+		t.Fatalf("expected the fencing token to increase but got %d after %d", next, token)
+	}
+
+	// the lease expires and the lock is acquired by another holder.
+	waitCtx, cancel = context.WithTimeout(ctx, 3*lease)
+	defer cancel()
+	last, err := db.LockContext(waitCtx, "sid", lease)
+	if err != nil {
+		t.Fatalf("expected the lock to be released after its lease but got %v", err)
+	}
+
+	if err = db.UnlockContext(ctx, "sid", next); err != sessions.ErrNotLocked {
+		t.Fatalf("expected %v for an expired holder but got %v", sessions.ErrNotLocked, err)
+	}
+
+	if err = db.UnlockContext(ctx, "sid", last); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	db := newTestDatabase(t)
+
+	ctx := context.Background()
+	sids := []string{"sid", "base64url_id"}
+	for _, sid := range sids {
+		if _, err := db.AcquireContext(ctx, sid, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		defer db.ReleaseContext(ctx, sid)
+
+		if err := db.SetContext(ctx, sid, sessions.LifeTime{Time: time.Now().Add(time.Minute)}, "key", "value", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a key of another application is not a session entry.
+	if err := db.redis.SetContext(ctx, "cache:x", "value", 60); err != nil {
+		t.Fatal(err)
+	}
+	defer db.redis.DeleteContext(ctx, "cache:x")
+
+	var got []string
+	if err := db.IterateContext(ctx, func(sid string) bool {
+		got = append(got, sid)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(sids) {
+		t.Fatalf("expected the session ids %v but got %v", sids, got)
+	}
+
+	for _, sid := range sids {
+		found := false
+		for _, g := range got {
+			found = found || g == sid
+		}
+
+		if !found {
+			t.Fatalf("expected the session id %q to be listed, got %v", sid, got)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"time"
@@ -13,8 +14,18 @@ var (
 	ErrRedisClosed = errors.New("redis is already closed")
 	// ErrKeyNotFound an error with message 'key not found'
 	ErrKeyNotFound = errors.New("key not found")
+	// ErrLockNotHeld an error with message 'lock not held',
+	// returned by `UnlockContext` when the lock is not held by the given token.
+	ErrLockNotHeld = errors.New("lock not held")
+	// ErrTxConflict an error with message 'transaction conflict',
+	// returned when a transaction could not be committed after `MaxTxRetries` attempts.
+	ErrTxConflict = errors.New("transaction conflict")
 )
 
+// MaxTxRetries is the maximum number of attempts of a transaction,
+// see `Service.UpdateContext`.
+var MaxTxRetries = 10
+
 // Service the Redis service, contains the config and the redis pool
 type Service struct {
 	// Connected is true when the Service has already connected
@@ -43,20 +54,40 @@ func (r *Service) CloseConnection() error {
 	return ErrRedisClosed
 }
 
+// getConn returns a connection from the pool, it respects the "ctx" deadline and cancelation.
+func (r *Service) getConn(ctx context.Context) (redis.Conn, error) {
+	c, err := r.pool.GetContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = c.Err(); err != nil {
+		c.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
 // Set sets a key-value to the redis store.
 // The expiration is setted by the MaxAgeSeconds.
-func (r *Service) Set(key string, value interface{}, secondsLifetime int64) (err error) {
-	c := r.pool.Get()
-	defer c.Close()
-	if c.Err() != nil {
-		return c.Err()
+func (r *Service) Set(key string, value interface{}, secondsLifetime int64) error {
+	return r.SetContext(context.Background(), key, value, secondsLifetime)
+}
+
+// SetContext same as `Set` but it accepts a context.
+func (r *Service) SetContext(ctx context.Context, key string, value interface{}, secondsLifetime int64) (err error) {
+	c, err := r.getConn(ctx)
+	if err != nil {
+		return err
 	}
+	defer c.Close()
 
 	// if has expiration, then use the "EX" to delete the key automatically.
 	if secondsLifetime > 0 {
-		_, err = c.Do("SETEX", r.Config.Prefix+key, secondsLifetime, value)
+		_, err = redis.DoContext(c, ctx, "SETEX", r.Config.Prefix+key, secondsLifetime, value)
 	} else {
-		_, err = c.Do("SET", r.Config.Prefix+key, value)
+		_, err = redis.DoContext(c, ctx, "SET", r.Config.Prefix+key, value)
 	}
 
 	return
@@ -65,13 +96,18 @@ func (r *Service) Set(key string, value interface{}, secondsLifetime int64) (err
 // Get returns value, err by its key
 // returns nil and a filled error if something bad happened.
 func (r *Service) Get(key string) (interface{}, error) {
-	c := r.pool.Get()
-	defer c.Close()
-	if err := c.Err(); err != nil {
+	return r.GetContext(context.Background(), key)
+}
+
+// GetContext same as `Get` but it accepts a context.
+func (r *Service) GetContext(ctx context.Context, key string) (interface{}, error) {
+	c, err := r.getConn(ctx)
+	if err != nil {
 		return nil, err
 	}
+	defer c.Close()
 
-	redisVal, err := c.Do("GET", r.Config.Prefix+key)
+	redisVal, err := redis.DoContext(c, ctx, "GET", r.Config.Prefix+key)
 
 	if err != nil {
 		return nil, err
@@ -85,22 +121,31 @@ func (r *Service) Get(key string) (interface{}, error) {
 // TTL returns the seconds to expire, if the key has expiration and error if action failed.
 // Read more at: https://redis.io/commands/ttl
 func (r *Service) TTL(key string) (seconds int64, hasExpiration bool, found bool) {
-	c := r.pool.Get()
+	seconds, hasExpiration, found, _ = r.TTLContext(context.Background(), key)
+	return
+}
+
+// TTLContext same as `TTL` but it accepts a context and it returns any connection error.
+func (r *Service) TTLContext(ctx context.Context, key string) (seconds int64, hasExpiration bool, found bool, err error) {
+	c, err := r.getConn(ctx)
+	if err != nil {
+		return -2, false, false, err
+	}
 	defer c.Close()
-	redisVal, err := c.Do("TTL", r.Config.Prefix+key)
+
+	seconds, err = redis.Int64(redis.DoContext(c, ctx, "TTL", r.Config.Prefix+key))
 	if err != nil {
-		return -2, false, false
+		return -2, false, false, err
 	}
-	seconds = redisVal.(int64)
 	// if -1 means the key has unlimited life time.
 	hasExpiration = seconds > -1
 	// if -2 means key does not exist.
-	found = !(c.Err() != nil || seconds == -2)
+	found = seconds != -2
 	return
 }
 
-func (r *Service) updateTTLConn(c redis.Conn, key string, newSecondsLifeTime int64) error {
-	reply, err := c.Do("EXPIRE", r.Config.Prefix+key, newSecondsLifeTime)
+func (r *Service) updateTTLConn(ctx context.Context, c redis.Conn, key string, newSecondsLifeTime int64) error {
+	reply, err := redis.DoContext(c, ctx, "EXPIRE", r.Config.Prefix+key, newSecondsLifeTime)
 
 	if err != nil {
 		return err
@@ -125,33 +170,42 @@ func (r *Service) updateTTLConn(c redis.Conn, key string, newSecondsLifeTime int
 // Using the "EXPIRE" command.
 // Read more at: https://redis.io/commands/expire#refreshing-expires
 func (r *Service) UpdateTTL(key string, newSecondsLifeTime int64) error {
-	c := r.pool.Get()
-	defer c.Close()
-	err := c.Err()
+	return r.UpdateTTLContext(context.Background(), key, newSecondsLifeTime)
+}
+
+// UpdateTTLContext same as `UpdateTTL` but it accepts a context.
+func (r *Service) UpdateTTLContext(ctx context.Context, key string, newSecondsLifeTime int64) error {
+	c, err := r.getConn(ctx)
 	if err != nil {
 		return err
 	}
+	defer c.Close()
 
-	return r.updateTTLConn(c, key, newSecondsLifeTime)
+	return r.updateTTLConn(ctx, c, key, newSecondsLifeTime)
 }
 
 // UpdateTTLMany like `UpdateTTL` but for all keys starting with that "prefix",
 // it is a bit faster operation if you need to update all sessions keys (although it can be even faster if we used hash but this will limit other features),
 // look the `sessions/Database#OnUpdateExpiration` for example.
 func (r *Service) UpdateTTLMany(prefix string, newSecondsLifeTime int64) error {
-	c := r.pool.Get()
-	defer c.Close()
-	if err := c.Err(); err != nil {
+	return r.UpdateTTLManyContext(context.Background(), prefix, newSecondsLifeTime)
+}
+
+// UpdateTTLManyContext same as `UpdateTTLMany` but it accepts a context.
+func (r *Service) UpdateTTLManyContext(ctx context.Context, prefix string, newSecondsLifeTime int64) error {
+	c, err := r.getConn(ctx)
+	if err != nil {
 		return err
 	}
+	defer c.Close()
 
-	keys, err := r.getKeysConn(c, prefix)
+	keys, err := r.getKeysConn(ctx, c, prefix)
 	if err != nil {
 		return err
 	}
 
 	for _, key := range keys {
-		if err = r.updateTTLConn(c, key, newSecondsLifeTime); err != nil { // fail on first error.
+		if err = r.updateTTLConn(ctx, c, key, newSecondsLifeTime); err != nil { // fail on first error.
 			return err
 		}
 	}
@@ -180,7 +234,11 @@ func (r *Service) GetAll() (interface{}, error) {
 	return redisVal, nil
 }
 
-func (r *Service) getKeysConn(c redis.Conn, prefix string) ([]string, error) {
+func (r *Service) getKeysConn(ctx context.Context, c redis.Conn, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
 	if err := c.Send("SCAN", 0, "MATCH", r.Config.Prefix+prefix+"*", "COUNT", 9999999999); err != nil {
 		return nil, err
 	}
@@ -213,16 +271,66 @@ func (r *Service) getKeysConn(c redis.Conn, prefix string) ([]string, error) {
 	return nil, nil
 }
 
+// scanConn calls the "cb" for each key matched by the "pattern", through the "SCAN" command, until the "cb" returns false.
+// It reports whether the "cb" returned false.
+func (r *Service) scanConn(ctx context.Context, c redis.Conn, pattern string, cb func(key string) bool) (bool, error) {
+	var cursor uint64
+	for {
+		values, err := redis.Values(redis.DoContext(c, ctx, "SCAN", cursor, "MATCH", r.Config.Prefix+pattern, "COUNT", 1000))
+		if err != nil {
+			return false, err
+		}
+
+		var keys []string
+		if _, err = redis.Scan(values, &cursor, &keys); err != nil {
+			return false, err
+		}
+
+		for _, key := range keys {
+			if !cb(key[len(r.Config.Prefix):]) {
+				return true, nil
+			}
+		}
+
+		if cursor == 0 {
+			return false, nil
+		}
+	}
+}
+
+// Scan calls the "cb" for each key matched by the "pattern", see `ScanContext`.
+func (r *Service) Scan(pattern string, cb func(key string) bool) error {
+	return r.ScanContext(context.Background(), pattern, cb)
+}
+
+// ScanContext calls the "cb" for each key matched by the "pattern" (without the `Config.Prefix`),
+// until the "cb" returns false. It iterates the whole database through the "SCAN" command.
+func (r *Service) ScanContext(ctx context.Context, pattern string, cb func(key string) bool) error {
+	c, err := r.getConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	_, err = r.scanConn(ctx, c, pattern, cb)
+	return err
+}
+
 // GetKeys returns all redis keys using the "SCAN" with MATCH command.
 // Read more at:  https://redis.io/commands/scan#the-match-option.
 func (r *Service) GetKeys(prefix string) ([]string, error) {
-	c := r.pool.Get()
-	defer c.Close()
-	if err := c.Err(); err != nil {
+	return r.GetKeysContext(context.Background(), prefix)
+}
+
+// GetKeysContext same as `GetKeys` but it accepts a context.
+func (r *Service) GetKeysContext(ctx context.Context, prefix string) ([]string, error) {
+	c, err := r.getConn(ctx)
+	if err != nil {
 		return nil, err
 	}
+	defer c.Close()
 
-	return r.getKeysConn(c, prefix)
+	return r.getKeysConn(ctx, c, prefix)
 }
 
 // GetBytes returns value, err by its key
@@ -249,13 +357,227 @@ func (r *Service) GetBytes(key string) ([]byte, error) {
 
 // Delete removes redis entry by specific key
 func (r *Service) Delete(key string) error {
-	c := r.pool.Get()
+	return r.DeleteContext(context.Background(), key)
+}
+
+// DeleteContext same as `Delete` but it accepts a context.
+func (r *Service) DeleteContext(ctx context.Context, key string) error {
+	c, err := r.getConn(ctx)
+	if err != nil {
+		return err
+	}
 	defer c.Close()
 
-	_, err := c.Do("DEL", r.Config.Prefix+key)
+	_, err = redis.DoContext(c, ctx, "DEL", r.Config.Prefix+key)
 	return err
 }
 
+// LockRetryInterval is the interval between the attempts of the `LockContext` to acquire a held lock.
+var LockRetryInterval = 50 * time.Millisecond
+
+var (
+	// KEYS[1] is the lock, KEYS[2] is the fencing counter and ARGV[1] the lease in milliseconds.
+	lockScript = redis.NewScript(2, `
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+local token = redis.call("INCR", KEYS[2])
+redis.call("SET", KEYS[1], token, "PX", ARGV[1])
+return token
+`)
+	// KEYS[1] is the lock and ARGV[1] the token of the holder.
+	unlockScript = redis.NewScript(1, `
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+)
+
+// Lock acquires the lock "key", see `LockContext`.
+func (r *Service) Lock(key, fenceKey string, lease time.Duration) (uint64, error) {
+	return r.LockContext(context.Background(), key, fenceKey, lease)
+}
+
+// LockContext acquires the lock "key", it blocks until the lock is acquired or the "ctx" is done.
+// The lock expires after the "lease" if it's not released by the `UnlockContext`.
+//
+// It returns the fencing token of the lock, the value of the "fenceKey" counter
+// which is incremented on each acquisition.
+func (r *Service) LockContext(ctx context.Context, key, fenceKey string, lease time.Duration) (uint64, error) {
+	c, err := r.getConn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	for {
+		token, err := redis.Uint64(lockScript.DoContext(ctx, c, r.Config.Prefix+key, r.Config.Prefix+fenceKey, lease.Milliseconds()))
+		if err != nil {
+			return 0, err
+		}
+
+		if token > 0 {
+			return token, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(LockRetryInterval):
+		}
+	}
+}
+
+// Unlock releases the lock "key", see `UnlockContext`.
+func (r *Service) Unlock(key string, token uint64) error {
+	return r.UnlockContext(context.Background(), key, token)
+}
+
+// UnlockContext releases the lock "key" if it's held by the "token",
+// otherwise it returns the `ErrLockNotHeld`, i.e. its lease has expired.
+func (r *Service) UnlockContext(ctx context.Context, key string, token uint64) error {
+	c, err := r.getConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	n, err := redis.Int(unlockScript.DoContext(ctx, c, r.Config.Prefix+key, token))
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrLockNotHeld
+	}
+
+	return nil
+}
+
+// Tx is an optimistic transaction, see `Service.UpdateContext`.
+type Tx struct {
+	r      *Service
+	c      redis.Conn
+	ctx    context.Context
+	writes []txWrite
+}
+
+type txWrite struct {
+	key             string
+	value           interface{}
+	secondsLifetime int64
+	deleted         bool
+}
+
+// Get watches the key and returns its value,
+// it returns a previous write of the same transaction first.
+func (tx *Tx) Get(key string) (interface{}, error) {
+	for i := len(tx.writes) - 1; i >= 0; i-- {
+		if w := tx.writes[i]; w.key == key {
+			if w.deleted {
+				return nil, ErrKeyNotFound
+			}
+
+			return w.value, nil
+		}
+	}
+
+	if _, err := redis.DoContext(tx.c, tx.ctx, "WATCH", tx.r.Config.Prefix+key); err != nil {
+		return nil, err
+	}
+
+	redisVal, err := redis.DoContext(tx.c, tx.ctx, "GET", tx.r.Config.Prefix+key)
+	if err != nil {
+		return nil, err
+	}
+	if redisVal == nil {
+		return nil, ErrKeyNotFound
+	}
+	return redisVal, nil
+}
+
+// Set sets a key-value on the transaction's commit.
+func (tx *Tx) Set(key string, value interface{}, secondsLifetime int64) {
+	tx.writes = append(tx.writes, txWrite{key: key, value: value, secondsLifetime: secondsLifetime})
+}
+
+// Delete removes a key on the transaction's commit.
+func (tx *Tx) Delete(key string) {
+	tx.writes = append(tx.writes, txWrite{key: key, deleted: true})
+}
+
+func (tx *Tx) exec() (bool, error) {
+	if len(tx.writes) == 0 {
+		_, err := redis.DoContext(tx.c, tx.ctx, "UNWATCH")
+		return true, err
+	}
+
+	if err := tx.c.Send("MULTI"); err != nil {
+		return false, err
+	}
+
+	for _, w := range tx.writes {
+		var err error
+		switch {
+		case w.deleted:
+			err = tx.c.Send("DEL", tx.r.Config.Prefix+w.key)
+		case w.secondsLifetime > 0:
+			err = tx.c.Send("SETEX", tx.r.Config.Prefix+w.key, w.secondsLifetime, w.value)
+		default:
+			err = tx.c.Send("SET", tx.r.Config.Prefix+w.key, w.value)
+		}
+
+		if err != nil {
+			return false, err
+		}
+	}
+
+	reply, err := redis.DoContext(tx.c, tx.ctx, "EXEC")
+	if err != nil {
+		return false, err
+	}
+
+	// a nil reply means that a watched key was modified in the meantime.
+	return reply != nil, nil
+}
+
+// Update runs "fn" as an optimistic transaction, see `UpdateContext`.
+func (r *Service) Update(fn func(tx *Tx) error) error {
+	return r.UpdateContext(context.Background(), fn)
+}
+
+// UpdateContext runs "fn" as an optimistic transaction (WATCH, MULTI and EXEC):
+// the keys read by "fn" are watched and its writes are executed atomically,
+// if a watched key was modified in the meantime the "fn" is called again, up to `MaxTxRetries` times.
+// The writes are discarded if "fn" returns an error.
+func (r *Service) UpdateContext(ctx context.Context, fn func(tx *Tx) error) error {
+	c, err := r.getConn(ctx)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+
+	for i := 0; i < MaxTxRetries; i++ {
+		tx := &Tx{r: r, c: c, ctx: ctx}
+		if err = fn(tx); err != nil {
+			redis.DoContext(c, ctx, "UNWATCH")
+			return err
+		}
+
+		committed, err := tx.exec()
+		if err != nil {
+			return err
+		}
+
+		if committed {
+			return nil
+		}
+	}
+
+	return ErrTxConflict
+}
+
 func dial(network string, addr string, pass string) (redis.Conn, error) {
 	if network == "" {
 		network = DefaultRedisNetwork
@@ -1,10 +1,13 @@
 package rediscluster
 
 import (
+	"context"
 	"log"
 	"runtime"
+	"strings"
 	"time"
 
+	redigo "github.com/gomodule/redigo/redis"
 	"github.com/kataras/go-sessions/v3"
 	"github.com/kataras/go-sessions/v3/sessiondb/rediscluster/service"
 )
@@ -14,7 +17,14 @@ type Database struct {
 	redis *service.Service
 }
 
-var _ sessions.Database = (*Database)(nil)
+var (
+	_ sessions.Database        = (*Database)(nil)
+	_ sessions.DatabaseContext = (*Database)(nil)
+	_ sessions.Exister         = (*Database)(nil)
+	_ sessions.Transactional   = (*Database)(nil)
+	_ sessions.Locker          = (*Database)(nil)
+	_ sessions.Iterator        = (*Database)(nil)
+)
 
 // New returns a new redis database.
 func New(cfg ...service.Config) *Database {
@@ -37,107 +47,322 @@ func (db *Database) Config() *service.Config {
 // Acquire receives a session's lifetime from the database,
 // if the return value is LifeTime{} then the session manager sets the life time based on the expiration duration lives in configuration.
 func (db *Database) Acquire(sid string, expires time.Duration) sessions.LifeTime {
-	seconds, hasExpiration, found := db.redis.TTL(sid)
+	lifetime, err := db.AcquireContext(context.Background(), sid, expires)
+	if err != nil {
+		return sessions.LifeTime{Time: sessions.CookieExpireDelete}
+	}
+
+	return lifetime
+}
+
+// AcquireContext same as `Acquire` but it accepts a context and it returns any redis error.
+func (db *Database) AcquireContext(ctx context.Context, sid string, expires time.Duration) (sessions.LifeTime, error) {
+	seconds, hasExpiration, found, err := db.redis.TTLContext(ctx, sid)
+	if err != nil {
+		return sessions.LifeTime{}, err
+	}
+
 	if !found {
 		// not found, create an entry with ttl and return an empty lifetime, session manager will do its job.
-		if err := db.redis.Set(sid, sid, int64(expires.Seconds())); err != nil {
-			return sessions.LifeTime{Time: sessions.CookieExpireDelete}
+		if err := db.redis.SetContext(ctx, sid, sid, int64(expires.Seconds())); err != nil {
+			return sessions.LifeTime{}, err
 		}
 
-		return sessions.LifeTime{} // session manager will handle the rest.
+		return sessions.LifeTime{}, nil // session manager will handle the rest.
 	}
 
 	if !hasExpiration {
-		return sessions.LifeTime{}
+		return sessions.LifeTime{}, nil
 
 	}
 
-	return sessions.LifeTime{Time: time.Now().Add(time.Duration(seconds) * time.Second)}
+	return sessions.LifeTime{Time: time.Now().Add(time.Duration(seconds) * time.Second)}, nil
+}
+
+// Exists reports whether a session entry with the given "sid" exists, see `sessions.Config.Strict`.
+func (db *Database) Exists(ctx context.Context, sid string) (bool, error) {
+	_, _, found, err := db.redis.TTLContext(ctx, sid)
+	return found, err
 }
 
 // OnUpdateExpiration will re-set the database's session's entry ttl.
 // https://redis.io/commands/expire#refreshing-expires
 func (db *Database) OnUpdateExpiration(sid string, newExpires time.Duration) error {
-	return db.redis.UpdateTTLMany(sid, int64(newExpires.Seconds()))
+	return db.OnUpdateExpirationContext(context.Background(), sid, newExpires)
+}
+
+// OnUpdateExpirationContext same as `OnUpdateExpiration` but it accepts a context.
+func (db *Database) OnUpdateExpirationContext(ctx context.Context, sid string, newExpires time.Duration) error {
+	seconds := int64(newExpires.Seconds())
+	// the session entry is the key of its id, its values live under the hash tag of the id ({sid}_key).
+	if err := db.redis.UpdateTTLContext(ctx, sid, seconds); err != nil {
+		return err
+	}
+
+	return db.redis.UpdateTTLManyContext(ctx, makeKey(sid, ""), seconds)
 }
 
 const delim = "_"
 
+// makeKey returns the redis key of a session's value,
+// the session id is a hash tag, so all the values of a session live on the same cluster slot
+// and they can be changed through a single transaction, see `UpdateContext`.
 func makeKey(sid, key string) string {
-	return sid + delim + key
+	return "{" + sid + "}" + delim + key
 }
 
 // Set sets a key value of a specific session.
 // Ignore the "immutable".
 func (db *Database) Set(sid string, lifetime sessions.LifeTime, key string, value interface{}, immutable bool) {
+	db.SetContext(context.Background(), sid, lifetime, key, value, immutable)
+}
+
+// SetContext same as `Set` but it accepts a context and it returns any encoding or redis error.
+func (db *Database) SetContext(ctx context.Context, sid string, lifetime sessions.LifeTime, key string, value interface{}, immutable bool) error {
 	valueBytes, err := sessions.DefaultTranscoder.Marshal(value)
 	if err != nil {
-		return
+		return err
 	}
 
-	db.redis.Set(makeKey(sid, key), valueBytes, int64(lifetime.DurationUntilExpiration().Seconds()))
+	return db.redis.SetContext(ctx, makeKey(sid, key), valueBytes, int64(lifetime.DurationUntilExpiration().Seconds()))
 }
 
 // Get retrieves a session value based on the key.
 func (db *Database) Get(sid string, key string) (value interface{}) {
-	db.get(makeKey(sid, key), &value)
+	value, _ = db.GetContext(context.Background(), sid, key)
 	return
 }
 
-func (db *Database) get(key string, outPtr interface{}) {
-	data, err := db.redis.Get(key)
-	if err != nil {
-		// not found.
-		return
-	}
-
-	sessions.DefaultTranscoder.Unmarshal(data.([]byte), outPtr)
+// GetContext same as `Get` but it accepts a context and it returns
+// a `sessions.ErrNotFound` if the key does not exist or any decoding or redis error.
+func (db *Database) GetContext(ctx context.Context, sid string, key string) (value interface{}, err error) {
+	err = db.get(ctx, makeKey(sid, key), &value)
+	return
 }
 
-func (db *Database) keys(sid string) []string {
-	keys, err := db.redis.GetKeys(sid + delim)
+func (db *Database) get(ctx context.Context, key string, outPtr interface{}) error {
+	data, err := db.redis.GetContext(ctx, key)
 	if err != nil {
-		return nil
+		if err == service.ErrKeyNotFound {
+			return sessions.ErrNotFound
+		}
+
+		return err
 	}
 
-	return keys
+	return sessions.DefaultTranscoder.Unmarshal(data.([]byte), outPtr)
+}
+
+func (db *Database) keys(ctx context.Context, sid string) ([]string, error) {
+	return db.redis.GetKeysContext(ctx, makeKey(sid, ""))
 }
 
 // Visit loops through all session keys and values.
 func (db *Database) Visit(sid string, cb func(key string, value interface{})) {
-	keys := db.keys(sid)
+	db.VisitContext(context.Background(), sid, cb)
+}
+
+// VisitContext same as `Visit` but it accepts a context and it returns any decoding or redis error.
+func (db *Database) VisitContext(ctx context.Context, sid string, cb func(key string, value interface{})) error {
+	keys, err := db.keys(ctx, sid)
+	if err != nil {
+		return err
+	}
+
+	prefix := makeKey(sid, "")
 	for _, key := range keys {
 		var value interface{} // new value each time, we don't know what user will do in "cb".
-		db.get(key, &value)
-		cb(key, value)
+		if err = db.get(ctx, key, &value); err != nil {
+			if err == sessions.ErrNotFound { // expired or removed in the meantime.
+				continue
+			}
+
+			return err
+		}
+
+		cb(strings.TrimPrefix(key, prefix), value)
 	}
+
+	return nil
 }
 
 // Len returns the length of the session's entries (keys).
 func (db *Database) Len(sid string) (n int) {
-	return len(db.keys(sid))
+	n, _ = db.LenContext(context.Background(), sid)
+	return
+}
+
+// LenContext same as `Len` but it accepts a context and it returns any redis error.
+func (db *Database) LenContext(ctx context.Context, sid string) (int, error) {
+	keys, err := db.keys(ctx, sid)
+	return len(keys), err
 }
 
 // Delete removes a session key value based on its key.
 func (db *Database) Delete(sid string, key string) (deleted bool) {
-	return db.redis.Delete(makeKey(sid, key)) == nil
+	deleted, _ = db.DeleteContext(context.Background(), sid, key)
+	return
+}
+
+// DeleteContext same as `Delete` but it accepts a context and it returns any redis error.
+func (db *Database) DeleteContext(ctx context.Context, sid string, key string) (bool, error) {
+	err := db.redis.DeleteContext(ctx, makeKey(sid, key))
+	return err == nil, err
 }
 
 // Clear removes all session key values but it keeps the session entry.
 func (db *Database) Clear(sid string) {
-	keys := db.keys(sid)
+	db.ClearContext(context.Background(), sid)
+}
+
+// ClearContext same as `Clear` but it accepts a context and it returns any redis error.
+func (db *Database) ClearContext(ctx context.Context, sid string) error {
+	keys, err := db.keys(ctx, sid)
+	if err != nil {
+		return err
+	}
+
 	for _, key := range keys {
-		db.redis.Delete(key)
+		if err = db.redis.DeleteContext(ctx, key); err != nil {
+			return err
+		}
 	}
+
+	return nil
 }
 
 // Release destroys the session, it clears and removes the session entry,
 // session manager will create a new session ID on the next request after this call.
 func (db *Database) Release(sid string) {
+	db.ReleaseContext(context.Background(), sid)
+}
+
+// ReleaseContext same as `Release` but it accepts a context and it returns any redis error.
+func (db *Database) ReleaseContext(ctx context.Context, sid string) error {
 	// clear all $sid-$key.
-	db.Clear(sid)
+	if err := db.ClearContext(ctx, sid); err != nil {
+		return err
+	}
 	// and remove the $sid.
-	db.redis.Delete(sid)
+	return db.redis.DeleteContext(ctx, sid)
+}
+
+// UpdateContext runs the "fn" in an optimistic transaction of redis on the cluster node of the session,
+// see the `sessions.Transactional` interface.
+func (db *Database) UpdateContext(ctx context.Context, sid string, lifetime sessions.LifeTime, fn func(tx sessions.Tx) error) error {
+	return db.redis.UpdateContext(ctx, makeKey(sid, ""), func(tx *service.Tx) error {
+		return fn(&sessionTx{tx: tx, sid: sid, secondsLifetime: int64(lifetime.DurationUntilExpiration().Seconds())})
+	})
+}
+
+// sessionTx adapts a redis transaction to a `sessions.Tx`.
+type sessionTx struct {
+	tx              *service.Tx
+	sid             string
+	secondsLifetime int64
+}
+
+func (t *sessionTx) Get(key string) (value interface{}, err error) {
+	data, err := t.tx.Get(makeKey(t.sid, key))
+	if err != nil {
+		if err == service.ErrKeyNotFound {
+			return nil, sessions.ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	if b, ok := data.([]byte); ok {
+		err = sessions.DefaultTranscoder.Unmarshal(b, &value)
+		return
+	}
+
+	return data, nil
+}
+
+func (t *sessionTx) Set(key string, value interface{}) error {
+	valueBytes, err := sessions.DefaultTranscoder.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	t.tx.Set(makeKey(t.sid, key), valueBytes, t.secondsLifetime)
+	return nil
+}
+
+func (t *sessionTx) Delete(key string) (bool, error) {
+	_, err := t.Get(key)
+	if err != nil && err != sessions.ErrNotFound {
+		return false, err
+	}
+
+	t.tx.Delete(makeKey(t.sid, key))
+	return err == nil, nil
+}
+
+// the lock keys are not prefixed by a session id, so they are not part of any session,
+// and they share the same hash tag, so the lock and the fencing counter live on the same cluster slot.
+const (
+	lockKeyPrefix = "{$locks}_"
+	fenceKey      = "{$locks}"
+)
+
+// LockContext acquires the lock of the session "sid" through a lease-based key with a fencing token,
+// see the `sessions.Locker` interface.
+func (db *Database) LockContext(ctx context.Context, sid string, lease time.Duration) (uint64, error) {
+	return db.redis.LockContext(ctx, lockKeyPrefix+sid, fenceKey, lease)
+}
+
+// UnlockContext releases the lock of the session "sid" if it's held by the "token",
+// see the `sessions.Locker` interface.
+func (db *Database) UnlockContext(ctx context.Context, sid string, token uint64) error {
+	err := db.redis.UnlockContext(ctx, lockKeyPrefix+sid, token)
+	if err == service.ErrLockNotHeld {
+		return sessions.ErrNotLocked
+	}
+
+	return err
+}
+
+// IterateContext calls the "cb" for each stored session id, through the "SCAN" command,
+// see the `sessions.Iterator` interface.
+// The session entries are recognized by their value, the session id itself, see `AcquireContext`,
+// so every key under the `service.Config.Prefix` is read: use a dedicated prefix on a shared redis.
+func (db *Database) IterateContext(ctx context.Context, cb func(sid string) bool) error {
+	var err error
+	scanErr := db.redis.ScanContext(ctx, "*", func(key string) bool {
+		var isEntry bool
+		if isEntry, err = db.isSessionEntry(ctx, key); err != nil {
+			return false
+		}
+
+		return !isEntry || cb(key)
+	})
+	if scanErr != nil {
+		return scanErr
+	}
+
+	return err
+}
+
+// isSessionEntry reports whether the "key" is the entry of a session,
+// the rest are its values, the locks or the keys of another application.
+func (db *Database) isSessionEntry(ctx context.Context, key string) (bool, error) {
+	value, err := db.redis.GetContext(ctx, key)
+	if err != nil {
+		if err == service.ErrKeyNotFound { // expired in the meantime.
+			return false, nil
+		}
+
+		if _, ok := err.(redigo.Error); ok { // not a string, i.e. a hash of another application.
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	b, ok := value.([]byte)
+	return ok && string(b) == key, nil
 }
 
 // Close terminates the redis connection.
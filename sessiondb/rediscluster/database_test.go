@@ -0,0 +1,119 @@
+package rediscluster
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/kataras/go-sessions/v3"
+	"github.com/kataras/go-sessions/v3/sessiondb/rediscluster/service"
+)
+
+// newTestDatabase connects to the redis cluster of the service.DefaultConfig,
+// the test is skipped if it's not running.
+func newTestDatabase(t *testing.T) *Database {
+	cfg := service.DefaultConfig()
+	cfg.Prefix = "go-sessions-test-" + time.Now().Format("150405.000000") + "-"
+
+	// the service.Connect exits if the cluster is not reachable.
+	c, err := redis.Dial(cfg.Network, cfg.Addr, redis.DialConnectTimeout(time.Second))
+	if err != nil {
+		t.Skipf("redis cluster is not available: %v", err)
+	}
+	_, err = c.Do("CLUSTER", "INFO")
+	c.Close()
+	if err != nil {
+		t.Skipf("redis cluster is not available: %v", err)
+	}
+
+	db := &Database{redis: service.New(cfg)}
+	db.redis.Connect()
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestUpdateExpiration(t *testing.T) {
+	db := newTestDatabase(t)
+
+	ctx := context.Background()
+	sid := "sid"
+	if _, err := db.AcquireContext(ctx, sid, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	defer db.ReleaseContext(ctx, sid)
+
+	lifetime := sessions.LifeTime{Time: time.Now().Add(time.Minute)}
+	if err := db.SetContext(ctx, sid, lifetime, "key", "value", false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.OnUpdateExpirationContext(ctx, sid, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{sid, makeKey(sid, "key")} {
+		seconds, _, found, err := db.redis.TTLContext(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !found || seconds <= int64(time.Minute.Seconds()) {
+			t.Fatalf("[%s] expected the expiration to be shifted to an hour but got %d seconds (found: %v)", key, seconds, found)
+		}
+	}
+	var keys []string
+	if err := db.VisitContext(ctx, sid, func(key string, _ interface{}) { keys = append(keys, key) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(keys) != 1 || keys[0] != "key" {
+		t.Fatalf("expected the values of the session's slot to be visited but got %v", keys)
+	}
+}
+
+func TestIterate(t *testing.T) {
+	db := newTestDatabase(t)
+
+	ctx := context.Background()
+	sids := []string{"sid", "base64url_id"}
+	for _, sid := range sids {
+		if _, err := db.AcquireContext(ctx, sid, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		defer db.ReleaseContext(ctx, sid)
+
+		if err := db.SetContext(ctx, sid, sessions.LifeTime{Time: time.Now().Add(time.Minute)}, "key", "value", false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a key of another application is not a session entry.
+	if err := db.redis.SetContext(ctx, "cache:x", "value", 60); err != nil {
+		t.Fatal(err)
+	}
+	defer db.redis.DeleteContext(ctx, "cache:x")
+
+	var got []string
+	if err := db.IterateContext(ctx, func(sid string) bool {
+		got = append(got, sid)
+		return true
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != len(sids) {
+		t.Fatalf("expected the session ids %v but got %v", sids, got)
+	}
+
+	for _, sid := range sids {
+		found := false
+		for _, g := range got {
+			found = found || g == sid
+		}
+
+		if !found {
+			t.Fatalf("expected the session id %q to be listed, got %v", sid, got)
+		}
+	}
+}
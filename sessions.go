@@ -26,8 +26,8 @@
 package sessions
 
 import (
+	"context"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/valyala/fasthttp"
@@ -48,6 +48,8 @@ const (
 type Sessions struct {
 	config   Config
 	provider *provider
+	cookies  *CookieStore
+	remember *rememberMe
 }
 
 // Default instance of the sessions, used for package-level functions.
@@ -55,10 +57,9 @@ var Default = New(Config{}.Validate())
 
 // New returns the fast, feature-rich sessions manager.
 func New(cfg Config) *Sessions {
-	return &Sessions{
-		config:   cfg.Validate(),
-		provider: newProvider(),
-	}
+	s := &Sessions{config: cfg.Validate()}
+	s.provider = newProvider(&s.config)
+	return s
 }
 
 // UseDatabase adds a session database to the manager's provider.
@@ -67,73 +68,32 @@ func UseDatabase(db Database) {
 }
 
 // UseDatabase adds a session database to the manager's provider.
+// If the "db" implements the `DatabaseContext` interface too then
+// that is used instead, otherwise the "db" is adapted to it.
 func (s *Sessions) UseDatabase(db Database) {
-	s.provider.RegisterDatabase(db)
+	s.provider.RegisterDatabase(newDatabaseContext(db))
 }
 
-// updateCookie gains the ability of updating the session browser cookie to any method which wants to update it
-func (s *Sessions) updateCookie(w http.ResponseWriter, r *http.Request, sid string, expires time.Duration) {
-	cookie := &http.Cookie{}
-
-	// The RFC makes no mention of encoding url value, so here I think to encode both sessionid key and the value using the safe(to put and to use as cookie) url-encoding
-	cookie.Name = s.config.Cookie
-
-	cookie.Value = sid
-	cookie.Path = "/"
-	if !s.config.DisableSubdomainPersistence {
-
-		requestDomain := r.URL.Host
-		if portIdx := strings.IndexByte(requestDomain, ':'); portIdx > 0 {
-			requestDomain = requestDomain[0:portIdx]
-		}
-		if IsValidCookieDomain(requestDomain) {
-
-			// RFC2109, we allow level 1 subdomains, but no further
-			// if we have localhost.com , we want the localhost.cos.
-			// so if we have something like: mysubdomain.localhost.com we want the localhost here
-			// if we have mysubsubdomain.mysubdomain.localhost.com we want the .mysubdomain.localhost.com here
-			// slow things here, especially the 'replace' but this is a good and understable( I hope) way to get the be able to set cookies from subdomains & domain with 1-level limit
-			if dotIdx := strings.LastIndexByte(requestDomain, '.'); dotIdx > 0 {
-				// is mysubdomain.localhost.com || mysubsubdomain.mysubdomain.localhost.com
-				s := requestDomain[0:dotIdx] // set mysubdomain.localhost || mysubsubdomain.mysubdomain.localhost
-				if secondDotIdx := strings.LastIndexByte(s, '.'); secondDotIdx > 0 {
-					//is mysubdomain.localhost ||  mysubsubdomain.mysubdomain.localhost
-					s = s[secondDotIdx+1:] // set to localhost || mysubdomain.localhost
-				}
-				// replace the s with the requestDomain before the domain's siffux
-				subdomainSuff := strings.LastIndexByte(requestDomain, '.')
-				if subdomainSuff > len(s) { // if it is actual exists as subdomain suffix
-					requestDomain = strings.Replace(requestDomain, requestDomain[0:subdomainSuff], s, 1) // set to localhost.com || mysubdomain.localhost.com
-				}
-			}
-			// finally set the .localhost.com (for(1-level) || .mysubdomain.localhost.com (for 2-level subdomain allow)
-			cookie.Domain = "." + requestDomain // . to allow persistence
-		}
-	}
+// UseDatabaseContext adds a context-aware session database to the manager's provider.
+func UseDatabaseContext(db DatabaseContext) {
+	Default.UseDatabaseContext(db)
+}
 
-	cookie.Domain = formatCookieDomain(r.URL.Host, s.config.DisableSubdomainPersistence)
-	cookie.HttpOnly = true
-	// MaxAge=0 means no 'Max-Age' attribute specified.
-	// MaxAge<0 means delete cookie now, equivalently 'Max-Age: 0'
-	// MaxAge>0 means Max-Age attribute present and given in seconds
-	if expires >= 0 {
-		if expires == 0 { // unlimited life
-			cookie.Expires = CookieExpireUnlimited
-		} else { // > 0
-			cookie.Expires = time.Now().Add(expires)
-		}
-		cookie.MaxAge = int(cookie.Expires.Sub(time.Now()).Seconds())
-	}
+// UseDatabaseContext adds a context-aware session database to the manager's provider.
+func (s *Sessions) UseDatabaseContext(db DatabaseContext) {
+	s.provider.RegisterDatabase(db)
+}
 
-	// set the cookie to secure if this is a tls wrapped request
-	// and the configuration allows it.
-	if r.TLS != nil && s.config.CookieSecureTLS {
-		cookie.Secure = true
-	}
+// getSessionID returns the client's decoded session id, if any.
+func (s *Sessions) getSessionID(r *http.Request) string {
+	return s.decodeCookieValue(s.config.Transport.Get(r))
+}
 
-	// encode the session id cookie client value right before send it.
-	cookie.Value = s.encodeCookieValue(cookie.Value)
-	AddCookie(w, r, cookie, s.config.AllowReclaim)
+// updateSessionID gains the ability of sending the session id
+// to the client to any method which wants to update it.
+func (s *Sessions) updateSessionID(w http.ResponseWriter, r *http.Request, sid string, expires time.Duration) {
+	// encode the session id client value right before send it.
+	s.config.Transport.Set(w, r, s.encodeCookieValue(sid), expires)
 }
 
 // Start starts the session for the particular request.
@@ -143,57 +103,108 @@ func Start(w http.ResponseWriter, r *http.Request) *Session {
 
 // Start starts the session for the particular request.
 func (s *Sessions) Start(w http.ResponseWriter, r *http.Request) *Session {
-	cookieValue := s.decodeCookieValue(GetCookie(r, s.config.Cookie))
+	s.provider.started.Store(true)
 
-	if cookieValue == "" { // cookie doesn't exists, let's generate a session and add set a cookie
-		sid := s.config.SessionIDGenerator()
+	if sess := s.fromContext(r.Context()); sess != nil { // started by the `Handler`.
+		return sess
+	}
 
-		sess := s.provider.Init(sid, s.config.Expires)
-		sess.isNew = s.provider.db.Len(sid) == 0
+	fingerprint := s.fingerprint(r)
 
-		s.updateCookie(w, r, sid, s.config.Expires)
+	if s.cookies != nil {
+		sess := s.cookieSession(r.Context(), s.config.Transport.Get(r))
+		if !s.verifyFingerprint(r.Context(), sess, fingerprint) {
+			sess = s.cookieSession(r.Context(), "")
+			s.bindFingerprint(r.Context(), sess, fingerprint)
+		}
 
+		s.restore(w, r, sess)
+		s.Commit(w, r, sess)
 		return sess
 	}
 
-	sess := s.provider.Read(cookieValue, s.config.Expires)
+	if cookieValue := s.getSessionID(r); cookieValue != "" {
+		verify := s.fingerprintVerifier(r.Context(), fingerprint)
+		if sess, shifted := s.provider.Read(r.Context(), cookieValue, s.config.Expires, verify); sess != nil {
+			if shifted && s.shouldReissue() {
+				lifetime := sess.lifetime()
+				s.updateSessionID(w, r, sess.ID(), lifetime.limit(s.config.Expires))
+			}
+
+			s.replaceInContext(r.Context(), sess)
+			s.restore(w, r, sess)
+			return sess
+		}
+		// unknown session id on strict mode or a fingerprint mismatch, a fresh one is issued.
+	}
+
+	if s.config.Lazy {
+		sess := s.lazySession(r.Context(), fingerprint, func(sid string) {
+			s.updateSessionID(w, r, sid, s.config.Expires)
+		})
+		s.restore(w, r, sess)
+		return sess
+	}
+
+	// cookie doesn't exists, let's generate a session and add set a cookie
+	sid := s.config.SessionIDGenerator()
+
+	sess := s.provider.Init(r.Context(), sid, s.config.Expires)
+	sess.isNew = s.provider.isEmpty(r.Context(), sid)
+	s.bindFingerprint(r.Context(), sess, fingerprint)
+
+	s.updateSessionID(w, r, sid, s.config.Expires)
+	s.replaceInContext(r.Context(), sess)
+	s.restore(w, r, sess)
 
 	return sess
 }
 
-func (s *Sessions) updateCookieFasthttp(ctx *fasthttp.RequestCtx, sid string, expires time.Duration) {
-	cookie := fasthttp.AcquireCookie()
-	defer fasthttp.ReleaseCookie(cookie)
+// lazySession returns a new session which is stored, and its id is sent to the client,
+// on its first write, see `Config.Lazy`. The session is bound to the client's "fingerprint" on its store.
+func (s *Sessions) lazySession(ctx context.Context, fingerprint string, sendID func(sid string)) *Session {
+	sess := &Session{
+		isNew:    true,
+		provider: s.provider,
+		flashes:  make(map[string]*flashMessage),
+	}
+	sess.setID(s.config.SessionIDGenerator())
 
-	// The RFC makes no mention of encoding url value, so here I think to encode both sessionid key and the value using the safe(to put and to use as cookie) url-encoding
-	cookie.SetKey(s.config.Cookie)
+	if s.config.WriteBehind {
+		sess.buffer = newWriteBuffer(sess)
+	}
 
-	cookie.SetValue(sid)
-	cookie.SetPath("/")
-	cookie.SetDomain(formatCookieDomain(string(ctx.Host()), s.config.DisableSubdomainPersistence))
+	rs := getRequestSession(ctx)
+	underHandler := rs != nil && rs.manager == s
 
-	cookie.SetHTTPOnly(true)
-	// MaxAge=0 means no 'Max-Age' attribute specified.
-	// MaxAge<0 means delete cookie now, equivalently 'Max-Age: 0'
-	// MaxAge>0 means Max-Age attribute present and given in seconds
-	if expires >= 0 {
-		if expires == 0 { // unlimited life
-			cookie.SetExpire(CookieExpireUnlimited)
-		} else { // > 0
-			cookie.SetExpire(time.Now().Add(expires))
+	sess.pending = func(ctx context.Context) {
+		s.provider.persist(ctx, sess, s.config.Expires)
+		s.bindFingerprint(ctx, sess, fingerprint)
+
+		if underHandler { // sent by the middleware, right before the response is written.
+			sess.lazyMu.Lock()
+			sess.idPending = true
+			sess.lazyMu.Unlock()
+			return
 		}
+
+		sendID(sess.ID())
 	}
 
-	// set the cookie to secure if this is a tls wrapped request
-	// and the configuration allows it.
+	s.replaceInContext(ctx, sess)
+	return sess
+}
 
-	if ctx.IsTLS() && s.config.CookieSecureTLS {
-		cookie.SetSecure(true)
-	}
+// getSessionIDFasthttp returns the client's decoded session id, if any.
+func (s *Sessions) getSessionIDFasthttp(ctx *fasthttp.RequestCtx) string {
+	return s.decodeCookieValue(s.config.Transport.GetFasthttp(ctx))
+}
 
-	// encode the session id cookie client value right before send it.
-	cookie.SetValue(s.encodeCookieValue(string(cookie.Value())))
-	AddCookieFasthttp(ctx, cookie)
+// updateSessionIDFasthttp gains the ability of sending the session id
+// to the client to any method which wants to update it.
+func (s *Sessions) updateSessionIDFasthttp(ctx *fasthttp.RequestCtx, sid string, expires time.Duration) {
+	// encode the session id client value right before send it.
+	s.config.Transport.SetFasthttp(ctx, s.encodeCookieValue(sid), expires)
 }
 
 // StartFasthttp starts the session for the particular request.
@@ -203,24 +214,173 @@ func StartFasthttp(ctx *fasthttp.RequestCtx) *Session {
 
 // StartFasthttp starts the session for the particular request.
 func (s *Sessions) StartFasthttp(ctx *fasthttp.RequestCtx) *Session {
-	cookieValue := s.decodeCookieValue(GetCookieFasthttp(ctx, s.config.Cookie))
+	s.provider.started.Store(true)
 
-	if cookieValue == "" { // cookie doesn't exists, let's generate a session and add set a cookie
-		sid := s.config.SessionIDGenerator()
+	if sess := s.fromContext(ctx); sess != nil { // started by the `HandlerFasthttp`.
+		return sess
+	}
 
-		sess := s.provider.Init(sid, s.config.Expires)
-		sess.isNew = s.provider.db.Len(sid) == 0
+	fingerprint := s.fingerprintFasthttp(ctx)
+
+	if s.cookies != nil {
+		sess := s.cookieSession(ctx, s.config.Transport.GetFasthttp(ctx))
+		if !s.verifyFingerprint(ctx, sess, fingerprint) {
+			sess = s.cookieSession(ctx, "")
+			s.bindFingerprint(ctx, sess, fingerprint)
+		}
+
+		s.restoreFasthttp(ctx, sess)
+		s.CommitFasthttp(ctx, sess)
+		return sess
+	}
+
+	if cookieValue := s.getSessionIDFasthttp(ctx); cookieValue != "" {
+		verify := s.fingerprintVerifier(ctx, fingerprint)
+		if sess, shifted := s.provider.Read(ctx, cookieValue, s.config.Expires, verify); sess != nil {
+			if shifted && s.shouldReissue() {
+				lifetime := sess.lifetime()
+				s.updateSessionIDFasthttp(ctx, sess.ID(), lifetime.limit(s.config.Expires))
+			}
 
-		s.updateCookieFasthttp(ctx, sid, s.config.Expires)
+			s.replaceInContext(ctx, sess)
+			s.restoreFasthttp(ctx, sess)
+			return sess
+		}
+		// unknown session id on strict mode or a fingerprint mismatch, a fresh one is issued.
+	}
 
+	if s.config.Lazy {
+		sess := s.lazySession(ctx, fingerprint, func(sid string) {
+			s.updateSessionIDFasthttp(ctx, sid, s.config.Expires)
+		})
+		s.restoreFasthttp(ctx, sess)
 		return sess
 	}
 
-	sess := s.provider.Read(cookieValue, s.config.Expires)
+	// cookie doesn't exists, let's generate a session and add set a cookie
+	sid := s.config.SessionIDGenerator()
+
+	sess := s.provider.Init(ctx, sid, s.config.Expires)
+	sess.isNew = s.provider.isEmpty(ctx, sid)
+	s.bindFingerprint(ctx, sess, fingerprint)
+
+	s.updateSessionIDFasthttp(ctx, sid, s.config.Expires)
+	s.replaceInContext(ctx, sess)
+	s.restoreFasthttp(ctx, sess)
 
 	return sess
 }
 
+// Regenerate moves the client's session under a fresh session id
+// and sends the new id to the client.
+// The session values, flash messages and lifetime are kept.
+//
+// Call it right after a privilege change (e.g. login)
+// in order to protect against session fixation attacks.
+func Regenerate(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	return Default.Regenerate(w, r)
+}
+
+// Regenerate moves the client's session under a fresh session id
+// and sends the new id to the client.
+// The session values, flash messages and lifetime are kept.
+//
+// Call it right after a privilege change (e.g. login)
+// in order to protect against session fixation attacks.
+func (s *Sessions) Regenerate(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	if s.cookies != nil {
+		sess := s.cookieSession(r.Context(), s.config.Transport.Get(r))
+		if err := s.provider.Regenerate(r.Context(), sess); err != nil {
+			return sess, err
+		}
+
+		return sess, s.Commit(w, r, sess)
+	}
+
+	cookieValue := s.getSessionID(r)
+	if cookieValue == "" { // no session yet, a fresh one is generated anyway.
+		return s.Start(w, r), nil
+	}
+
+	sess, _ := s.provider.Read(r.Context(), cookieValue, s.config.Expires, nil)
+	if sess == nil { // unknown session id on strict mode, a fresh one is generated anyway.
+		return s.Start(w, r), nil
+	}
+
+	if err := s.provider.Regenerate(r.Context(), sess); err != nil {
+		return sess, err
+	}
+
+	// the old session id is not valid anymore, next `Start` calls of the same request
+	// see the new one under the `Handler` middleware or the `Config.AllowReclaim`.
+	s.updateSessionID(w, r, sess.ID(), s.cookieExpires(sess))
+	return sess, nil
+}
+
+// RegenerateFasthttp moves the client's session under a fresh session id
+// and sends the new id to the client.
+// The session values, flash messages and lifetime are kept.
+//
+// Call it right after a privilege change (e.g. login)
+// in order to protect against session fixation attacks.
+func RegenerateFasthttp(ctx *fasthttp.RequestCtx) (*Session, error) {
+	return Default.RegenerateFasthttp(ctx)
+}
+
+// RegenerateFasthttp moves the client's session under a fresh session id
+// and sends the new id to the client.
+// The session values, flash messages and lifetime are kept.
+//
+// Call it right after a privilege change (e.g. login)
+// in order to protect against session fixation attacks.
+func (s *Sessions) RegenerateFasthttp(ctx *fasthttp.RequestCtx) (*Session, error) {
+	if s.cookies != nil {
+		sess := s.cookieSession(ctx, s.config.Transport.GetFasthttp(ctx))
+		if err := s.provider.Regenerate(ctx, sess); err != nil {
+			return sess, err
+		}
+
+		return sess, s.CommitFasthttp(ctx, sess)
+	}
+
+	cookieValue := s.getSessionIDFasthttp(ctx)
+	if cookieValue == "" { // no session yet, a fresh one is generated anyway.
+		return s.StartFasthttp(ctx), nil
+	}
+
+	sess, _ := s.provider.Read(ctx, cookieValue, s.config.Expires, nil)
+	if sess == nil { // unknown session id on strict mode, a fresh one is generated anyway.
+		return s.StartFasthttp(ctx), nil
+	}
+
+	if err := s.provider.Regenerate(ctx, sess); err != nil {
+		return sess, err
+	}
+
+	// the old session id is not valid anymore, next `StartFasthttp` calls of the same request
+	// see the new one under the `Handler` middleware or the `Config.AllowReclaim`.
+	s.updateSessionIDFasthttp(ctx, sess.ID(), s.cookieExpires(sess))
+	return sess, nil
+}
+
+// shouldReissue reports whether the client's session id should be sent again
+// after its session's expiration was moved forward, see `Config.SlidingExpiration`.
+// A session id with unlimited or browser-session life does not need that.
+func (s *Sessions) shouldReissue() bool {
+	return s.config.SlidingExpiration && s.config.Expires > 0
+}
+
+// cookieExpires returns the duration that the client's cookie should live
+// in order to match the remaining lifetime of the "sess".
+func (s *Sessions) cookieExpires(sess *Session) time.Duration {
+	lifetime := sess.lifetime()
+	if lifetime.IsZero() {
+		return s.config.Expires
+	}
+
+	return lifetime.DurationUntilExpiration()
+}
+
 // ShiftExpiration move the expire date of a session to a new date
 // by using session default timeout configuration.
 func ShiftExpiration(w http.ResponseWriter, r *http.Request) {
@@ -256,15 +416,29 @@ func UpdateExpiration(w http.ResponseWriter, r *http.Request, expires time.Durat
 // It will return `ErrNotFound` when trying to update expiration on a non-existence or not valid session entry.
 // It will return `ErrNotImplemented` if a database is used and it does not support this feature, yet.
 func (s *Sessions) UpdateExpiration(w http.ResponseWriter, r *http.Request, expires time.Duration) error {
-	cookieValue := s.decodeCookieValue(GetCookie(r, s.config.Cookie))
+	if s.cookies != nil {
+		value := s.config.Transport.Get(r)
+		if value == "" {
+			return ErrNotFound
+		}
+
+		sess := s.cookieSession(r.Context(), value)
+		if err := updateCookieExpiration(sess, expires); err != nil {
+			return err
+		}
+
+		return s.Commit(w, r, sess)
+	}
+
+	cookieValue := s.getSessionID(r)
 	if cookieValue == "" {
 		return ErrNotFound
 	}
 
 	// we should also allow it to expire when the browser closed
-	err := s.provider.UpdateExpiration(cookieValue, expires)
+	err := s.provider.UpdateExpiration(r.Context(), cookieValue, expires)
 	if err == nil || expires == -1 {
-		s.updateCookie(w, r, cookieValue, expires)
+		s.updateSessionID(w, r, cookieValue, expires)
 	}
 
 	return err
@@ -279,15 +453,29 @@ func UpdateExpirationFasthttp(ctx *fasthttp.RequestCtx, expires time.Duration) {
 // UpdateExpirationFasthttp change expire date of a session to a new date
 // by using timeout value passed by `expires` receiver.
 func (s *Sessions) UpdateExpirationFasthttp(ctx *fasthttp.RequestCtx, expires time.Duration) error {
-	cookieValue := s.decodeCookieValue(GetCookieFasthttp(ctx, s.config.Cookie))
+	if s.cookies != nil {
+		value := s.config.Transport.GetFasthttp(ctx)
+		if value == "" {
+			return ErrNotFound
+		}
+
+		sess := s.cookieSession(ctx, value)
+		if err := updateCookieExpiration(sess, expires); err != nil {
+			return err
+		}
+
+		return s.CommitFasthttp(ctx, sess)
+	}
+
+	cookieValue := s.getSessionIDFasthttp(ctx)
 	if cookieValue == "" {
 		return ErrNotFound
 	}
 
 	// we should also allow it to expire when the browser closed
-	err := s.provider.UpdateExpiration(cookieValue, expires)
+	err := s.provider.UpdateExpiration(ctx, cookieValue, expires)
 	if err == nil || expires == -1 {
-		s.updateCookieFasthttp(ctx, cookieValue, expires)
+		s.updateSessionIDFasthttp(ctx, cookieValue, expires)
 	}
 
 	return err
@@ -301,7 +489,7 @@ func (s *Sessions) destroy(cookieValue string) {
 		return
 	}
 
-	s.provider.Destroy(cookieValue)
+	s.provider.Destroy(cookieValue, ReasonDestroy)
 }
 
 // DestroyListener is the form of a destroy listener.
@@ -312,6 +500,8 @@ type DestroyListener func(sid string)
 // A destroy listener is fired when a session has been removed entirely from the server (the entry) and client-side (the cookie).
 // Note that if a destroy listener is blocking, then the session manager will delay respectfully,
 // use a goroutine inside the listener to avoid that behavior.
+//
+// Use the `OnDestroyEvent` to receive the reason and the session's values as well.
 func (s *Sessions) OnDestroy(listeners ...DestroyListener) {
 	for _, ln := range listeners {
 		s.provider.registerDestroyListener(ln)
@@ -322,6 +512,8 @@ func (s *Sessions) OnDestroy(listeners ...DestroyListener) {
 // A destroy listener is fired when a session has been removed entirely from the server (the entry) and client-side (the cookie).
 // Note that if a destroy listener is blocking, then the session manager will delay respectfully,
 // use a goroutine inside the listener to avoid that behavior.
+//
+// Use the `OnDestroyEvent` to receive the reason and the session's values as well.
 func OnDestroy(listeners ...DestroyListener) {
 	Default.OnDestroy(listeners...)
 }
@@ -333,9 +525,25 @@ func Destroy(w http.ResponseWriter, r *http.Request) {
 
 // Destroy remove the session data and remove the associated cookie.
 func (s *Sessions) Destroy(w http.ResponseWriter, r *http.Request) {
-	cookieValue := GetCookie(r, s.config.Cookie)
-	s.destroy(cookieValue)
-	RemoveCookie(w, r, s.config)
+	if s.cookies != nil {
+		if sess := s.fromContext(r.Context()); sess != nil {
+			sess.Destroy()
+		} else if value := s.config.Transport.Get(r); value != "" {
+			s.cookieSession(r.Context(), value).Destroy()
+		}
+
+		s.config.Transport.Remove(w, r)
+		return
+	}
+
+	if sess := s.fromContext(r.Context()); sess != nil { // i.e. a lazy session of the middleware, its id may not be sent yet.
+		sess.Destroy()
+	} else {
+		cookieValue := s.config.Transport.Get(r)
+		s.destroy(cookieValue)
+	}
+
+	s.config.Transport.Remove(w, r)
 }
 
 // DestroyFasthttp remove the session data and remove the associated cookie.
@@ -345,9 +553,25 @@ func DestroyFasthttp(ctx *fasthttp.RequestCtx) {
 
 // DestroyFasthttp remove the session data and remove the associated cookie.
 func (s *Sessions) DestroyFasthttp(ctx *fasthttp.RequestCtx) {
-	cookieValue := GetCookieFasthttp(ctx, s.config.Cookie)
-	s.destroy(cookieValue)
-	RemoveCookieFasthttp(ctx, s.config)
+	if s.cookies != nil {
+		if sess := s.fromContext(ctx); sess != nil {
+			sess.Destroy()
+		} else if value := s.config.Transport.GetFasthttp(ctx); value != "" {
+			s.cookieSession(ctx, value).Destroy()
+		}
+
+		s.config.Transport.RemoveFasthttp(ctx)
+		return
+	}
+
+	if sess := s.fromContext(ctx); sess != nil { // i.e. a lazy session of the middleware, its id may not be sent yet.
+		sess.Destroy()
+	} else {
+		cookieValue := s.config.Transport.GetFasthttp(ctx)
+		s.destroy(cookieValue)
+	}
+
+	s.config.Transport.RemoveFasthttp(ctx)
 }
 
 // DestroyByID removes the session entry
@@ -370,8 +594,16 @@ func DestroyByID(sid string) {
 //
 // Note: the sid should be the original one (i.e: fetched by a store )
 // it's not decoded.
+//
+// A client-side session id, see `UseCookieStore`, is revoked instead.
 func (s *Sessions) DestroyByID(sid string) {
-	s.provider.Destroy(sid)
+	if s.cookies != nil {
+		s.cookies.revoke(context.Background(), sid, time.Time{})
+		s.provider.fireDestroy(DestroyEvent{ID: sid, Reason: ReasonDestroyByID})
+		return
+	}
+
+	s.provider.Destroy(sid, ReasonDestroyByID)
 }
 
 // DestroyAll removes all sessions
@@ -384,6 +616,8 @@ func DestroyAll() {
 // DestroyAll removes all sessions
 // from the server-side memory (and database if registered).
 // Client's session cookie will still exist but it will be reseted on the next request.
+//
+// The client-side sessions, see `UseCookieStore`, are not affected.
 func (s *Sessions) DestroyAll() {
 	s.provider.DestroyAll()
 }
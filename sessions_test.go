@@ -1,19 +1,24 @@
 package sessions
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	// developers can use any library to add a custom cookie encoder/decoder.
 	// At this test code we use the gorilla's securecookie library:
 	"github.com/gavv/httpexpect"
 
 	"github.com/gorilla/securecookie"
+	"github.com/valyala/fasthttp"
 )
 
 var errReadBody = errors.New("While trying to read from the request body")
@@ -271,3 +276,1536 @@ func TestFlashMessages(t *testing.T) {
 	//	e.GET("/get/").Expect().Status(http.StatusOK).JSON().Object().Equal(values)
 	e.GET("/get_single/").Expect().Status(http.StatusOK).Body().Equal(valueSingleValue)
 }
+
+func TestRegenerate(t *testing.T) {
+	manager := New(Config{Cookie: "regenerate_sid", AllowReclaim: true})
+	mux := http.NewServeMux()
+
+	var oldSid string
+
+	mux.HandleFunc("/set/", func(res http.ResponseWriter, req *http.Request) {
+		sess := manager.Start(res, req)
+		sess.Set("name", "go-sessions")
+		sess.SetFlash("notice", "logged in")
+		oldSid = sess.ID()
+	})
+
+	mux.HandleFunc("/regenerate/", func(res http.ResponseWriter, req *http.Request) {
+		sess, err := manager.Regenerate(res, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sess.ID() == oldSid {
+			t.Fatalf("expected a fresh session id but got the old one: %s", oldSid)
+		}
+		// same request should resolve the new session.
+		if got := manager.Start(res, req).ID(); got != sess.ID() {
+			t.Fatalf("expected %s but got %s", sess.ID(), got)
+		}
+		if _, found := manager.provider.sessions[oldSid]; found {
+			t.Fatalf("expected old session id to be released")
+		}
+	})
+
+	mux.HandleFunc("/get/", func(res http.ResponseWriter, req *http.Request) {
+		sess := manager.Start(res, req)
+		res.Write([]byte(sess.GetString("name") + "|" + sess.GetFlashString("notice")))
+	})
+
+	e := getTester(mux, t)
+
+	e.GET("/set/").Expect().Status(http.StatusOK).Cookie("regenerate_sid").Value().Equal(oldSid)
+	e.GET("/regenerate/").Expect().Status(http.StatusOK).Cookie("regenerate_sid").Value().NotEqual(oldSid)
+	e.GET("/get/").Expect().Status(http.StatusOK).Body().Equal("go-sessions|logged in")
+
+	sess := manager.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	sess.SetImmutable("role", "admin")
+	if err := sess.Regenerate(); err != nil {
+		t.Fatal(err)
+	}
+
+	sess.Set("role", "guest")
+	if role := sess.GetString("role"); role != "admin" {
+		t.Fatalf("expected the entry to be kept immutable after a regenerate but got %s", role)
+	}
+}
+
+type legacyDatabase struct {
+	values map[string]map[string]interface{}
+	// flashReads counts the reads of the flash messages.
+	flashReads int
+}
+
+func (db *legacyDatabase) Acquire(sid string, expires time.Duration) LifeTime {
+	if _, ok := db.values[sid]; !ok {
+		db.values[sid] = make(map[string]interface{})
+	}
+	return LifeTime{}
+}
+func (db *legacyDatabase) OnUpdateExpiration(string, time.Duration) error { return nil }
+func (db *legacyDatabase) Set(sid string, lifetime LifeTime, key string, value interface{}, immutable bool) {
+	db.values[sid][key] = value
+}
+func (db *legacyDatabase) Get(sid string, key string) interface{} {
+	if key == flashesKey {
+		db.flashReads++
+	}
+	return db.values[sid][key]
+}
+func (db *legacyDatabase) Visit(sid string, cb func(key string, value interface{})) {
+	for k, v := range db.values[sid] {
+		cb(k, v)
+	}
+}
+func (db *legacyDatabase) Len(sid string) int { return len(db.values[sid]) }
+func (db *legacyDatabase) Delete(sid string, key string) bool {
+	_, ok := db.values[sid][key]
+	delete(db.values[sid], key)
+	return ok
+}
+func (db *legacyDatabase) Clear(sid string)   { db.values[sid] = make(map[string]interface{}) }
+func (db *legacyDatabase) Release(sid string) { delete(db.values, sid) }
+
+func TestSessionErrors(t *testing.T) {
+	for _, db := range []Database{nil, &legacyDatabase{values: make(map[string]map[string]interface{})}} {
+		manager := New(Config{})
+		if db != nil {
+			manager.UseDatabase(db)
+		}
+
+		sess := manager.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		ctx := context.Background()
+
+		if _, err := sess.GetE(ctx, "missing"); err != ErrNotFound {
+			t.Fatalf("expected ErrNotFound but got: %v", err)
+		}
+
+		if err := sess.SetE(ctx, "name", "go-sessions"); err != nil {
+			t.Fatal(err)
+		}
+
+		if v, err := sess.GetE(ctx, "name"); err != nil || v != "go-sessions" {
+			t.Fatalf("expected go-sessions but got: %v (%v)", v, err)
+		}
+
+		if deleted, err := sess.DeleteE(ctx, "name"); err != nil || !deleted {
+			t.Fatalf("expected entry to be deleted: %v", err)
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	manager := New(Config{Cookie: "handler_sid"})
+
+	handler := manager.Handler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		sess := FromContext(req.Context())
+		if sess == nil {
+			t.Fatalf("expected a session stored to the request's context")
+		}
+
+		if started := manager.Start(res, req); started != sess {
+			t.Fatalf("expected the same session on Start")
+		}
+
+		sess.Set("name", "go-sessions")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if n := len(rec.Result().Cookies()); n != 1 {
+		t.Fatalf("expected a single Set-Cookie header but got %d", n)
+	}
+}
+
+func TestHandlerHijack(t *testing.T) {
+	manager := New(Config{WriteBehind: true})
+
+	srv := httptest.NewServer(manager.Handler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		FromContext(req.Context()).Set("name", "go-sessions")
+
+		hijacker, ok := res.(http.Hijacker)
+		if !ok {
+			t.Errorf("expected the response writer to implement the http.Hijacker")
+			return
+		}
+
+		conn, buf, err := hijacker.Hijack()
+		if err != nil {
+			t.Errorf("expected no error on hijack but got %v", err)
+			return
+		}
+		defer conn.Close()
+
+		buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 2\r\nConnection: close\r\n\r\nok")
+		buf.Flush()
+	})))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if body, _ := io.ReadAll(resp.Body); string(body) != "ok" {
+		t.Fatalf("expected the hijacked connection's response but got %q", body)
+	}
+}
+
+func TestHeaderTransport(t *testing.T) {
+	manager := New(Config{Transport: NewBearerTransport()})
+
+	var sid string
+	handler := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		sess := manager.Start(res, req)
+		if sid == "" {
+			sid = sess.ID()
+			sess.Set("name", "go-sessions")
+			return
+		}
+
+		if sess.ID() != sid {
+			t.Fatalf("expected session id %s but got %s", sid, sess.ID())
+		}
+
+		if name := sess.GetString("name"); name != "go-sessions" {
+			t.Fatalf("expected name value to be kept but got %q", name)
+		}
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := rec.Header().Get(DefaultHeader); got != sid || got == "" {
+		t.Fatalf("expected %s response header to be %s but got %s", DefaultHeader, sid, got)
+	}
+	if n := len(rec.Result().Cookies()); n != 0 {
+		t.Fatalf("expected no cookies but got %d", n)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", "Bearer "+sid)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+}
+
+func TestCookieOptions(t *testing.T) {
+	manager := New(Config{
+		Cookie:            "__Host-sid",
+		CookiePath:        "/admin",
+		CookieDomain:      "example.com",
+		CookieSameSite:    http.SameSiteStrictMode,
+		CookiePartitioned: true,
+		CookieOptions: func(c *http.Cookie) {
+			c.HttpOnly = false
+		},
+	})
+
+	expected := []string{"__Host-sid=", "Path=/", "Secure", "SameSite=Strict", "Partitioned"}
+	check := func(name string, setCookie string) {
+		for _, part := range expected {
+			if !strings.Contains(setCookie, part) {
+				t.Fatalf("[%s] expected %q to contain %q", name, setCookie, part)
+			}
+		}
+
+		if strings.Contains(setCookie, "Domain") || strings.Contains(setCookie, "HttpOnly") || strings.Contains(setCookie, "/admin") {
+			t.Fatalf("[%s] expected cookie options and the __Host- prefix to be respected but got: %q", name, setCookie)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	manager.Start(rec, req)
+	check("net/http start", rec.Header().Get("Set-Cookie"))
+
+	req.AddCookie(&http.Cookie{Name: "__Host-sid", Value: rec.Result().Cookies()[0].Value})
+	rec = httptest.NewRecorder()
+	manager.Destroy(rec, req)
+	check("net/http remove", rec.Header().Get("Set-Cookie"))
+
+	ctx := new(fasthttp.RequestCtx)
+	ctx.Request.SetRequestURI("/admin")
+	manager.StartFasthttp(ctx)
+	check("fasthttp start", string(ctx.Response.Header.Peek("Set-Cookie")))
+
+	ctx.Response.Reset()
+	manager.DestroyFasthttp(ctx)
+	check("fasthttp remove", string(ctx.Response.Header.Peek("Set-Cookie")))
+}
+
+func TestTimeouts(t *testing.T) {
+	db := &legacyDatabase{values: make(map[string]map[string]interface{})}
+	cfg := Config{IdleTimeout: time.Hour, AbsoluteTimeout: 90 * time.Minute}
+
+	manager := New(cfg)
+	manager.UseDatabase(db)
+
+	rec := httptest.NewRecorder()
+	sess := manager.Start(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !sess.IsNew() {
+		t.Fatalf("expected a new session, the reserved keys should not count")
+	}
+	sess.Set("name", "go-sessions")
+
+	if _, ok := sess.GetAll()[createdKey]; ok {
+		t.Fatalf("expected the reserved keys to be hidden from the session's values")
+	}
+
+	if until := sess.Lifetime.DurationUntilExpiration(); until > time.Hour {
+		t.Fatalf("expected the idle timeout to control the lifetime but got %s", until)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: sess.ID()})
+	if err := manager.UpdateExpiration(httptest.NewRecorder(), req, 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if until := sess.Lifetime.DurationUntilExpiration(); until > 90*time.Minute {
+		t.Fatalf("expected the absolute timeout to limit the lifetime but got %s", until)
+	}
+
+	// simulate an application restart after the absolute timeout.
+	db.values[sess.ID()][createdKey] = time.Now().Add(-2 * time.Hour).Format(time.RFC3339Nano)
+
+	restarted := New(cfg)
+	restarted.UseDatabase(db)
+
+	if name := restarted.Start(httptest.NewRecorder(), req).GetString("name"); name != "" {
+		t.Fatalf("expected the session to be expired by the absolute timeout but got name: %q", name)
+	}
+}
+
+func TestConcurrentRequests(t *testing.T) {
+	manager := New(Config{IdleTimeout: 20 * time.Millisecond})
+
+	rec := httptest.NewRecorder()
+	manager.Start(rec, httptest.NewRequest(http.MethodGet, "/", nil)).Set("name", "go-sessions")
+	cookie := rec.Result().Cookies()[0]
+
+	// the expiration is moved by each request while the timer may fire, run with -race.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.AddCookie(cookie)
+				manager.Start(httptest.NewRecorder(), r).Set("visits", j)
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestConcurrentRegenerate(t *testing.T) {
+	manager := New(Config{})
+	sess := manager.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	sess.Set("name", "go-sessions")
+
+	// a request regenerates the id on login while another one reads the session, run with -race.
+	started, done := make(chan struct{}), make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		close(started)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				sess.ID()
+				sess.Get("name")
+			}
+		}
+	}()
+
+	<-started
+	for i := 0; i < 100; i++ {
+		if err := sess.Regenerate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if name := sess.GetString("name"); name != "go-sessions" {
+		t.Fatalf("expected the values to be kept after a regenerate but got %q", name)
+	}
+}
+
+// slowDatabase blocks the visit of the "sid" values until the "resume" is closed.
+type slowDatabase struct {
+	DatabaseContext
+	sid              string
+	once             sync.Once
+	visiting, resume chan struct{}
+}
+
+func (db *slowDatabase) VisitContext(ctx context.Context, sid string, cb func(key string, value interface{})) error {
+	if sid == db.sid {
+		db.once.Do(func() { close(db.visiting) })
+		<-db.resume
+	}
+
+	return db.DatabaseContext.VisitContext(ctx, sid, cb)
+}
+
+func TestRegenerateOutsideProviderLock(t *testing.T) {
+	db := &slowDatabase{DatabaseContext: newMemDB(), visiting: make(chan struct{}), resume: make(chan struct{})}
+	manager := New(Config{})
+	manager.UseDatabaseContext(db)
+
+	sess := manager.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	sess.Set("name", "go-sessions")
+	db.sid = sess.ID()
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- sess.Regenerate() }()
+	<-db.visiting
+
+	// the values are moved through the database while the other sessions are served.
+	started := make(chan struct{})
+	go func() {
+		manager.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		close(started)
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatalf("expected a session to be started while another one is regenerated")
+	}
+
+	close(db.resume)
+	if err := <-errCh; err != nil {
+		t.Fatal(err)
+	}
+
+	if name := sess.GetString("name"); name != "go-sessions" {
+		t.Fatalf("expected the values to be moved to the new session id but got %q", name)
+	}
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	manager := New(Config{Expires: time.Hour, SlidingExpiration: true})
+
+	sess := manager.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: sess.ID()})
+
+	rec := httptest.NewRecorder()
+	manager.Start(rec, req)
+	if rec.Header().Get("Set-Cookie") != "" {
+		t.Fatalf("expected no cookie while the remaining lifetime is above the refresh fraction")
+	}
+
+	sess.Lifetime.Time = time.Now().Add(10 * time.Minute)
+
+	rec = httptest.NewRecorder()
+	manager.Start(rec, req)
+	if rec.Header().Get("Set-Cookie") == "" {
+		t.Fatalf("expected the cookie to be sent again after sliding")
+	}
+
+	if until := sess.Lifetime.DurationUntilExpiration(); until < 50*time.Minute {
+		t.Fatalf("expected the expiration to be moved forward but got %s", until)
+	}
+}
+
+func TestCookieStore(t *testing.T) {
+	store, err := NewCookieStore([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tooLarge error
+	store.ErrorHandler = func(sid string, err error) {
+		tooLarge = err
+	}
+
+	manager := New(Config{Expires: time.Hour})
+	manager.UseCookieStore(store)
+
+	handler := manager.Handler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		sess := FromContext(req.Context())
+		switch req.URL.Path {
+		case "/set":
+			sess.Set("name", "go-sessions")
+			sess.SetFlash("notice", "saved")
+		case "/get":
+			io.WriteString(res, sess.GetString("name")+" "+sess.GetFlashString("notice"))
+		case "/large":
+			sess.Set("large", strings.Repeat("x", DefaultCookieMaxSize))
+		case "/destroy":
+			manager.Destroy(res, req)
+		}
+	}))
+
+	serve := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	cookies := serve("/set", nil).Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("expected a single session cookie but got %d", len(cookies))
+	}
+	cookie := cookies[0]
+
+	if body := serve("/get", cookie).Body.String(); body != "go-sessions saved" {
+		t.Fatalf("expected the session to be decoded by the client's cookie but got: %q", body)
+	}
+
+	if serve("/large", cookie); tooLarge != ErrCookieTooLarge {
+		t.Fatalf("expected %v but got %v", ErrCookieTooLarge, tooLarge)
+	}
+
+	serve("/destroy", cookie)
+	if body := serve("/get", cookie).Body.String(); body != " " {
+		t.Fatalf("expected the destroyed session's cookie to be revoked but got: %q", body)
+	}
+}
+
+func TestStrict(t *testing.T) {
+	manager := New(Config{Strict: true})
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: "forged"})
+
+	rec := httptest.NewRecorder()
+	sess := manager.Start(rec, req)
+	if sess.ID() == "forged" {
+		t.Fatalf("expected an unknown session id to be discarded")
+	}
+
+	if cookies := rec.Result().Cookies(); len(cookies) != 1 || cookies[0].Value != sess.ID() {
+		t.Fatalf("expected a fresh session id to be issued")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: sess.ID()})
+	if got := manager.Start(httptest.NewRecorder(), req); got != sess {
+		t.Fatalf("expected a known session id to be accepted")
+	}
+}
+
+func TestLazy(t *testing.T) {
+	manager := New(Config{Lazy: true})
+
+	handler := manager.Handler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		sess := FromContext(req.Context())
+		switch req.URL.Path {
+		case "/set":
+			sess.Set("name", "go-sessions")
+		case "/flash":
+			sess.SetFlash("name", "go-sessions")
+		}
+
+		res.Write([]byte(sess.GetString("name")))
+	}))
+
+	serve := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	if cookies := serve("/get", nil).Result().Cookies(); len(cookies) != 0 {
+		t.Fatalf("expected no session cookie before the first write but got %d", len(cookies))
+	}
+
+	manager.provider.mu.Lock()
+	n := len(manager.provider.sessions)
+	manager.provider.mu.Unlock()
+	if n != 0 {
+		t.Fatalf("expected no stored session before the first write but got %d", n)
+	}
+
+	for _, path := range []string{"/set", "/flash"} {
+		cookies := serve(path, nil).Result().Cookies()
+		if len(cookies) != 1 {
+			t.Fatalf("[%s] expected a single session cookie after the first write but got %d", path, len(cookies))
+		}
+
+		if path == "/set" {
+			if body := serve("/get", cookies[0]).Body.String(); body != "go-sessions" {
+				t.Fatalf("expected the lazy session to be stored but got: %q", body)
+			}
+		}
+	}
+}
+
+func TestDestroyEvent(t *testing.T) {
+	manager := New(Config{Expires: 50 * time.Millisecond})
+
+	events := make(chan DestroyEvent, 2)
+	manager.OnDestroyEvent(func(evt DestroyEvent) {
+		// the listeners can use the manager.
+		if manager.Count() != 0 || manager.Lookup(evt.ID) != nil {
+			t.Errorf("expected the session to be removed before its event")
+		}
+		manager.DestroyByID(evt.ID)
+
+		events <- evt
+	})
+
+	start := func() *Session {
+		sess := manager.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		sess.Set("cart", "go-sessions")
+		return sess
+	}
+
+	expect := func(sess *Session, reason DestroyReason) {
+		select {
+		case evt := <-events:
+			if evt.ID != sess.ID() || evt.Reason != reason {
+				t.Fatalf("expected a %q event of %s but got a %q event of %s", reason, sess.ID(), evt.Reason, evt.ID)
+			}
+
+			if got := evt.Values.GetString("cart"); got != "go-sessions" {
+				t.Fatalf("expected the values snapshot to be taken before the release but got: %q", got)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected a %q event", reason)
+		}
+	}
+
+	sess := start()
+	sess.Destroy()
+	sess.Destroy()
+	expect(sess, ReasonDestroy)
+
+	sess = start()
+	manager.DestroyByID(sess.ID())
+	expect(sess, ReasonDestroyByID)
+
+	expect(start(), ReasonExpired)
+
+	select {
+	case evt := <-events:
+		t.Fatalf("expected a single event for each session but got a %q event", evt.Reason)
+	default:
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	db := &legacyDatabase{values: make(map[string]map[string]interface{})}
+	manager := New(Config{Expires: time.Hour})
+	manager.UseDatabase(db)
+
+	var events []string
+	manager.OnCreate(func(sess *Session) { events = append(events, "create") })
+	manager.OnLoad(func(sess *Session) { events = append(events, "load") })
+	manager.OnSet(func(sess *Session, key string, value interface{}) { events = append(events, "set "+key) })
+	manager.OnDelete(func(sess *Session, key string) { events = append(events, "delete "+key) })
+	manager.OnExpirationUpdate(func(sess *Session) { events = append(events, "expiration") })
+
+	rec := httptest.NewRecorder()
+	sess := manager.Start(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	sess.Set("name", "go-sessions")
+	sess.Delete("name")
+	sess.Set("name", "go-sessions")
+	if err := manager.provider.UpdateExpiration(context.Background(), sess.ID(), 2*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	// simulate a restart, the session is read back from the database.
+	restarted := New(Config{Expires: time.Hour})
+	restarted.UseDatabase(db)
+	restarted.OnLoad(func(sess *Session) { events = append(events, "load") })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: sess.ID()})
+	restarted.Start(httptest.NewRecorder(), req)
+
+	expected := []string{"create", "set name", "delete name", "set name", "expiration", "load"}
+	if strings.Join(events, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected events %v but got %v", expected, events)
+	}
+
+	// a session with only a flash message is read back too.
+	events = nil
+	rec = httptest.NewRecorder()
+	manager.Start(rec, httptest.NewRequest(http.MethodGet, "/", nil)).SetFlash("notice", "saved")
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(rec.Result().Cookies()[0])
+	restarted.Start(httptest.NewRecorder(), req)
+
+	if expected = []string{"create", "load"}; strings.Join(events, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected events %v but got %v", expected, events)
+	}
+}
+
+func TestFlashesDatabase(t *testing.T) {
+	db := &legacyDatabase{values: make(map[string]map[string]interface{})}
+	nodeA, nodeB := New(Config{}), New(Config{})
+	nodeA.UseDatabase(db)
+	nodeB.UseDatabase(db)
+
+	rec := httptest.NewRecorder()
+	nodeA.Start(rec, httptest.NewRequest(http.MethodGet, "/", nil)).SetFlash("notice", "saved")
+	cookie := rec.Result().Cookies()[0]
+
+	start := func(node *Sessions) *Session {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookie)
+		return node.Start(httptest.NewRecorder(), req)
+	}
+
+	if got := start(nodeB).GetFlashString("notice"); got != "saved" {
+		t.Fatalf("expected the flash message to be available to another node but got: %q", got)
+	}
+
+	if start(nodeA).HasFlash() {
+		t.Fatalf("expected the flash message to be removed after it has been read")
+	}
+
+	if len(start(nodeB).GetAll()) != 0 {
+		t.Fatalf("expected the flash messages to not be part of the session's values")
+	}
+
+	reads := db.flashReads
+	start(nodeA).Set("name", "go-sessions")
+	if db.flashReads != reads {
+		t.Fatalf("expected the flash messages to be loaded only when they are used")
+	}
+}
+
+func TestGet(t *testing.T) {
+	type profile struct {
+		Name string `json:"name"`
+	}
+
+	sess := New(Config{}).Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	// the representations that a JSON transcoder returns.
+	sess.Set("int", float64(42))
+	sess.Set("string_int", "42")
+	sess.Set("float", 1.5)
+	sess.Set("profile", map[string]interface{}{"name": "go-sessions"})
+
+	if v, err := Get[int](sess, "int"); err != nil || v != 42 {
+		t.Fatalf("expected 42 but got %v: %v", v, err)
+	}
+
+	if v, err := Get[int64](sess, "string_int"); err != nil || v != 42 {
+		t.Fatalf("expected 42 but got %v: %v", v, err)
+	}
+
+	if _, err := Get[int](sess, "float"); err == nil {
+		t.Fatalf("expected a non-integral float to not be converted to int")
+	}
+
+	if v, err := Get[profile](sess, "profile"); err != nil || v.Name != "go-sessions" {
+		t.Fatalf("expected the profile struct but got %#v: %v", v, err)
+	}
+
+	if _, err := Get[string](sess, "missing"); err != ErrNotFound {
+		t.Fatalf("expected %v but got %v", ErrNotFound, err)
+	}
+
+	if v := GetOr(sess, "missing", "default"); v != "default" {
+		t.Fatalf("expected the default value but got %q", v)
+	}
+
+	userID := NewKey[int64]("user_id")
+	userID.Set(sess, 7)
+	if v := userID.GetOr(sess, -1); v != 7 {
+		t.Fatalf("expected 7 but got %d", v)
+	}
+}
+
+func TestBind(t *testing.T) {
+	type (
+		base struct {
+			UserID int64 `session:"user_id"`
+		}
+		model struct {
+			base
+			Name     string   `session:"name"`
+			Roles    []string `session:"roles"`
+			Cart     string   `session:"cart,omitempty"`
+			Internal string   `session:"-"`
+		}
+	)
+
+	sess := New(Config{}).Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	sess.Set("cart", "item")
+
+	if err := sess.Save(model{base: base{UserID: 1}, Name: "go-sessions", Roles: []string{"admin"}, Internal: "x"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if sess.Get("cart") != nil || sess.Get("Internal") != nil {
+		t.Fatalf("expected the omitempty and skipped fields to not be stored")
+	}
+
+	// the representations that a JSON transcoder returns.
+	sess.Set("user_id", float64(1))
+	sess.Set("roles", []interface{}{"admin"})
+
+	var got model
+	if err := sess.Bind(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.UserID != 1 || got.Name != "go-sessions" || len(got.Roles) != 1 || got.Roles[0] != "admin" {
+		t.Fatalf("unexpected bound model: %#v", got)
+	}
+
+	if err := sess.SaveDocument("profile", got); err != nil {
+		t.Fatal(err)
+	}
+	sess.Set("profile", map[string]interface{}{"Name": "document"})
+
+	var doc model
+	if err := sess.BindDocument("profile", &doc); err != nil || doc.Name != "document" {
+		t.Fatalf("expected the document to be bound but got %#v: %v", doc, err)
+	}
+
+	if err := sess.Bind(got); err != ErrBindTarget {
+		t.Fatalf("expected %v but got %v", ErrBindTarget, err)
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	for name, db := range map[string]Database{
+		"memory": nil,
+		"legacy": &legacyDatabase{values: make(map[string]map[string]interface{})},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sessions := New(Config{})
+			if db != nil {
+				sessions.UseDatabase(db)
+			}
+
+			sess := sessions.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+			var wg sync.WaitGroup
+			for i := 0; i < 50; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					sess.Increment("counter", 1)
+				}()
+			}
+			wg.Wait()
+
+			if v := sess.GetIntDefault("counter", 0); v != 50 {
+				t.Fatalf("expected 50 but got %d", v)
+			}
+
+			errAbort := errors.New("abort")
+			err := sess.Update(func(tx *SessionTx) error {
+				tx.Set("a", "changed")
+				return errAbort
+			})
+			if err != errAbort || sess.Get("a") != nil {
+				t.Fatalf("expected the changes of a failed update to be discarded but got %v: %v", sess.Get("a"), err)
+			}
+
+			err = sess.Update(func(tx *SessionTx) error {
+				if err := tx.Set("a", "1"); err != nil {
+					return err
+				}
+				_, err := tx.Delete("counter")
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if sess.GetString("a") != "1" || sess.Get("counter") != nil {
+				t.Fatalf("expected the changes of the update to be committed")
+			}
+
+			// the session can be read inside the update.
+			if err = sess.Update(func(tx *SessionTx) error {
+				return tx.Set("b", sess.GetString("a"))
+			}); err != nil || sess.GetString("b") != "1" {
+				t.Fatalf("expected the session to be readable inside the update: %v", err)
+			}
+
+			if n, err := sess.DecrementE(context.Background(), "counter", 2); err != nil || n != -2 {
+				t.Fatalf("expected -2 but got %d: %v", n, err)
+			}
+
+			if db == nil { // only the memory database keeps the immutable entries.
+				sess.SetImmutable("role", "user")
+				if err = sess.Update(func(tx *SessionTx) error { return tx.Set("role", "admin") }); err != nil {
+					t.Fatal(err)
+				}
+
+				sess.Set("role", "guest")
+				if role := sess.GetString("role"); role != "admin" {
+					t.Fatalf("expected the entry to be kept immutable after the update but got %s", role)
+				}
+			}
+		})
+	}
+}
+
+type countingDatabase struct {
+	*legacyDatabase
+	gets, sets int
+}
+
+func (db *countingDatabase) Get(sid string, key string) interface{} {
+	db.gets++
+	return db.legacyDatabase.Get(sid, key)
+}
+
+func (db *countingDatabase) Set(sid string, lifetime LifeTime, key string, value interface{}, immutable bool) {
+	db.sets++
+	db.legacyDatabase.Set(sid, lifetime, key, value, immutable)
+}
+
+func TestWriteBehind(t *testing.T) {
+	db := &countingDatabase{legacyDatabase: &legacyDatabase{values: make(map[string]map[string]interface{})}}
+	sessions := New(Config{WriteBehind: true})
+	sessions.UseDatabase(db)
+
+	var sid string
+	handler := sessions.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess := FromContext(r.Context())
+		sid = sess.ID()
+		for i := 0; i < 10; i++ {
+			sess.Increment("counter", 1)
+			sess.GetString("name")
+		}
+		sess.Set("name", "go-sessions")
+
+		if db.sets != 0 || db.gets != 0 {
+			t.Fatalf("expected the changes to be buffered but got %d sets and %d gets", db.sets, db.gets)
+		}
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if db.sets != 2 {
+		t.Fatalf("expected the changed keys to be written once but got %d writes", db.sets)
+	}
+
+	if v := db.values[sid]["counter"]; v != 10 {
+		t.Fatalf("expected 10 but got %v", v)
+	}
+
+	// the values are loaded again on the next request, i.e. changed by another instance.
+	db.values[sid]["name"] = "changed"
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(rec.Result().Cookies()[0])
+	sess := sessions.Start(httptest.NewRecorder(), req)
+	if got := sess.GetString("name"); got != "changed" {
+		t.Fatalf("expected the values to be loaded again but got %q", got)
+	}
+
+	sess.Delete("name")
+	if err := sess.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := db.values[sid]["name"]; ok {
+		t.Fatalf("expected the removed key to be deleted from the database on commit")
+	}
+}
+
+func TestLock(t *testing.T) {
+	sessions := New(Config{LockLease: 50 * time.Millisecond})
+
+	rec := httptest.NewRecorder()
+	sessions.Start(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookie := rec.Result().Cookies()[0]
+
+	handler := sessions.LockHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sess := sessions.Start(w, r)
+		n := sess.GetIntDefault("counter", 0)
+		time.Sleep(time.Millisecond) // read-modify-write race without the lock.
+		sess.Set("counter", n+1)
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.AddCookie(cookie)
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}()
+	}
+	wg.Wait()
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(cookie)
+	sess := sessions.Start(httptest.NewRecorder(), req)
+	if v := sess.GetIntDefault("counter", 0); v != 10 {
+		t.Fatalf("expected the requests to be serialized, 10 but got %d", v)
+	}
+
+	lock, err := sess.Lock(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := lock.Token()
+
+	// the lease expires and the lock is acquired by another holder.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	nextToken, err := sessions.provider.locker().LockContext(ctx, sess.ID(), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if nextToken <= token {
+		t.Fatalf("expected the fencing token to increase but got %d after %d", nextToken, token)
+	}
+
+	if err = lock.Unlock(); err != ErrNotLocked {
+		t.Fatalf("expected %v but got %v", ErrNotLocked, err)
+	}
+}
+
+func TestLockHandlerLeaseExpired(t *testing.T) {
+	const lease = 200 * time.Millisecond
+	sessions := New(Config{LockLease: lease})
+
+	rec := httptest.NewRecorder()
+	sess := sessions.Start(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookie := rec.Result().Cookies()[0]
+
+	entered := make(chan struct{}, 2)
+	handler := sessions.LockHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		time.Sleep(lease + lease/2) // longer than the lease.
+	}))
+
+	serve := func(wg *sync.WaitGroup) {
+		defer wg.Done()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.AddCookie(cookie)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	var first, second sync.WaitGroup
+	first.Add(1)
+	go serve(&first)
+	<-entered
+
+	second.Add(1)
+	go serve(&second) // acquires the lock once the lease of the first one expires.
+	<-entered
+
+	// the first request ends while the second one holds the lock,
+	// it should not release the lock of the second one.
+	first.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), lease/4)
+	defer cancel()
+	if _, err := sessions.provider.locker().LockContext(ctx, sess.ID(), lease); err == nil {
+		t.Fatalf("expected the lock to be held by the second request")
+	}
+
+	second.Wait()
+}
+
+func TestEach(t *testing.T) {
+	sessions := New(Config{})
+	revoked := NewDatabaseDenylist(sessions.provider.db)
+
+	var sids []string
+	for i := 0; i < 3; i++ {
+		sess := sessions.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		sess.Set("user", i)
+		sids = append(sids, sess.ID())
+	}
+	sessions.DestroyByID(sids[2])
+	revoked.Revoke(context.Background(), sids[2], time.Now().Add(time.Minute))
+
+	if n := sessions.Count(); n != 2 {
+		t.Fatalf("expected 2 sessions but got %d", n)
+	}
+
+	seen := make(map[string]bool)
+	sessions.Each(func(sess *Session) bool {
+		seen[sess.ID()] = true
+		return true
+	})
+
+	if len(seen) != 2 || !seen[sids[0]] || !seen[sids[1]] {
+		t.Fatalf("expected the alive sessions to be enumerated but got %v", seen)
+	}
+
+	if sess := sessions.Lookup(sids[1]); sess == nil || sess.GetIntDefault("user", -1) != 1 {
+		t.Fatalf("expected to find the session %s", sids[1])
+	}
+
+	if sessions.Lookup(sids[2]) != nil || sessions.Lookup("unknown") != nil {
+		t.Fatalf("expected a nil session for a destroyed or an unknown session id")
+	}
+
+	if n := sessions.Count(); n != 2 {
+		t.Fatalf("expected the lookup to not create a session but got %d sessions", n)
+	}
+
+	// a session of another instance is a read-only view of it.
+	db := &legacyDatabase{values: make(map[string]map[string]interface{})}
+	nodeA, nodeB := New(Config{}), New(Config{})
+	nodeA.UseDatabase(db)
+	nodeB.UseDatabase(db)
+
+	sid := nodeA.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil)).ID()
+	nodeA.Lookup(sid).Set("user", "kataras")
+
+	sess := nodeB.Lookup(sid)
+	if sess == nil || sess.GetString("user") != "kataras" {
+		t.Fatalf("expected to find the session %s of another instance", sid)
+	}
+
+	if err := sess.SetE(context.Background(), "user", "makis"); err != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly but got %v", err)
+	}
+
+	if _, found := nodeB.provider.sessions[sid]; found {
+		t.Fatalf("expected the session of another instance to not be held in memory")
+	}
+}
+
+func TestOwner(t *testing.T) {
+	sessions := New(Config{})
+
+	var destroyed []string
+	sessions.OnDestroyEvent(func(evt DestroyEvent) {
+		if evt.Reason == ReasonDestroyOwner {
+			destroyed = append(destroyed, evt.ID)
+		}
+	})
+
+	start := func() *Session {
+		return sessions.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+
+	laptop, phone, other := start(), start(), start()
+	laptop.SetOwner("kataras")
+	phone.SetOwner("kataras")
+	other.SetOwner("makis")
+
+	if owner := laptop.Owner(); owner != "kataras" {
+		t.Fatalf("expected owner kataras but got %q", owner)
+	}
+
+	laptop.Set("key", "value")
+	laptop.Clear()
+	if owner := laptop.Owner(); owner != "kataras" {
+		t.Fatalf("expected the owner to survive a clear but got %q", owner)
+	}
+
+	if err := sessions.provider.Regenerate(context.Background(), phone); err != nil {
+		t.Fatal(err)
+	}
+
+	sids := sessions.SessionsOf("kataras")
+	if len(sids) != 2 || !(sids[0] == laptop.ID() || sids[1] == laptop.ID()) || !(sids[0] == phone.ID() || sids[1] == phone.ID()) {
+		t.Fatalf("expected the sessions %s and %s but got %v", laptop.ID(), phone.ID(), sids)
+	}
+
+	if n := sessions.Count(); n != 3 {
+		t.Fatalf("expected the owners' index to not be counted as a session but got %d sessions", n)
+	}
+
+	sessions.DestroyOwner("kataras")
+	if len(destroyed) != 2 {
+		t.Fatalf("expected 2 destroy events but got %v", destroyed)
+	}
+
+	if sids = sessions.SessionsOf("kataras"); len(sids) != 0 {
+		t.Fatalf("expected no sessions but got %v", sids)
+	}
+
+	if sessions.Lookup(laptop.ID()) != nil || sessions.Lookup(phone.ID()) != nil {
+		t.Fatalf("expected the owner's sessions to be destroyed")
+	}
+
+	if sids = sessions.SessionsOf("makis"); len(sids) != 1 || sids[0] != other.ID() {
+		t.Fatalf("expected the session of another owner to be kept but got %v", sids)
+	}
+}
+
+func TestMaxSessionsPerOwner(t *testing.T) {
+	login := func(sessions *Sessions) (*Session, error) {
+		sess := sessions.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+		return sess, sess.SetOwnerE(context.Background(), "kataras")
+	}
+
+	use := func(sessions *Sessions, sess *Session) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: sess.ID()})
+		sessions.Start(httptest.NewRecorder(), r)
+	}
+
+	tests := []struct {
+		policy  OwnerLimitPolicy
+		evicted int // the index of the evicted session, -1 for a rejected login.
+	}{
+		{OwnerLimitReject, -1},
+		{OwnerLimitEvictOldest, 0},
+		{OwnerLimitEvictLRU, 1},
+	}
+
+	for _, tt := range tests {
+		sessions := New(Config{MaxSessionsPerOwner: 2, OwnerLimitPolicy: tt.policy})
+
+		var evicted []string
+		sessions.OnDestroyEvent(func(evt DestroyEvent) {
+			if evt.Reason == ReasonEvicted {
+				evicted = append(evicted, evt.ID)
+			}
+		})
+
+		first, _ := login(sessions)
+		time.Sleep(time.Millisecond)
+		second, _ := login(sessions)
+		time.Sleep(time.Millisecond)
+		use(sessions, first)
+
+		third, err := login(sessions)
+		if tt.evicted == -1 {
+			if err != ErrOwnerLimit {
+				t.Fatalf("[%d] expected the ErrOwnerLimit but got %v", tt.policy, err)
+			}
+
+			if third.Owner() != "" || len(sessions.SessionsOf("kataras")) != 2 {
+				t.Fatalf("[%d] expected the new session to not be bound to the owner", tt.policy)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatalf("[%d] %v", tt.policy, err)
+		}
+
+		expected := []*Session{first, second}[tt.evicted]
+		if len(evicted) != 1 || evicted[0] != expected.ID() {
+			t.Fatalf("[%d] expected the session %s to be evicted but got %v", tt.policy, expected.ID(), evicted)
+		}
+
+		if sids := sessions.SessionsOf("kataras"); len(sids) != 2 {
+			t.Fatalf("[%d] expected 2 sessions but got %v", tt.policy, sids)
+		}
+	}
+}
+
+func TestMaxSessionsPerOwnerConcurrent(t *testing.T) {
+	for _, policy := range []OwnerLimitPolicy{OwnerLimitReject, OwnerLimitEvictOldest} {
+		sessions := New(Config{MaxSessionsPerOwner: 2, OwnerLimitPolicy: policy})
+
+		var (
+			wg       sync.WaitGroup
+			mu       sync.Mutex
+			accepted int
+		)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				sess := sessions.Start(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+				if err := sess.SetOwnerE(context.Background(), "kataras"); err == nil {
+					mu.Lock()
+					accepted++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		if policy == OwnerLimitReject && accepted != 2 {
+			t.Fatalf("expected 2 concurrent logins to be accepted but got %d", accepted)
+		}
+
+		if sids := sessions.SessionsOf("kataras"); len(sids) != 2 {
+			t.Fatalf("[%d] expected 2 sessions but got %v", policy, sids)
+		}
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	start := func(sessions *Sessions, sid, userAgent string) (*Session, *httptest.ResponseRecorder) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("User-Agent", userAgent)
+		if sid != "" {
+			r.AddCookie(&http.Cookie{Name: DefaultCookieName, Value: sid})
+		}
+
+		rec := httptest.NewRecorder()
+		return sessions.Start(rec, r), rec
+	}
+
+	for _, policy := range []FingerprintPolicy{FingerprintReject, FingerprintDestroy, FingerprintReport} {
+		sessions := New(Config{Fingerprint: UserAgentFingerprint{}, FingerprintPolicy: policy, IdleTimeout: time.Hour})
+
+		mismatches := 0
+		sessions.OnFingerprintMismatch(func(*Session) { mismatches++ })
+
+		sess, _ := start(sessions, "", "browser")
+		sess.Set("user", "kataras")
+		sid := sess.ID()
+
+		if same, _ := start(sessions, sid, "browser"); same.ID() != sid || mismatches != 0 {
+			t.Fatalf("[%d] expected the session to be kept for the same client", policy)
+		}
+
+		expiresAt := sess.Lifetime.Time
+		stolen, _ := start(sessions, sid, "attacker")
+		if mismatches != 1 {
+			t.Fatalf("[%d] expected a mismatch to be reported but got %d", policy, mismatches)
+		}
+
+		switch policy {
+		case FingerprintReject:
+			if stolen.ID() == sid || stolen.Get("user") != nil {
+				t.Fatalf("expected a fresh session for a different client")
+			}
+
+			if !sess.Lifetime.Time.Equal(expiresAt) {
+				t.Fatalf("expected a rejected request to not move the session's expiration")
+			}
+
+			if owner, _ := start(sessions, sid, "browser"); owner.ID() != sid || owner.GetString("user") != "kataras" {
+				t.Fatalf("expected the session to be kept for its client")
+			}
+		case FingerprintDestroy:
+			if stolen.ID() == sid || stolen.Get("user") != nil {
+				t.Fatalf("expected a fresh session for a different client")
+			}
+
+			if owner, _ := start(sessions, sid, "browser"); owner.Get("user") != nil {
+				t.Fatalf("expected the stolen session to be destroyed")
+			}
+		case FingerprintReport:
+			if stolen.ID() != sid || stolen.GetString("user") != "kataras" {
+				t.Fatalf("expected the session to be accepted")
+			}
+		}
+	}
+
+	fingerprint, err := NewIPFingerprint("10.0.0.0/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Add("X-Forwarded-For", "198.51.100.7, 203.0.113.42, 10.0.0.2")
+	if got := fingerprint.Fingerprint(r); got != "203.0.113.0/24" {
+		t.Fatalf("expected the client's network through the trusted proxies but got %s", got)
+	}
+
+	r.RemoteAddr = "192.0.2.10:1234"
+	if got := fingerprint.Fingerprint(r); got != "192.0.2.0/24" {
+		t.Fatalf("expected the forwarded header of an untrusted peer to be ignored but got %s", got)
+	}
+}
+
+func TestRememberMe(t *testing.T) {
+	sessions := New(Config{AllowReclaim: true})
+
+	var restored, stolen []string
+	sessions.UseRememberMe(RememberMe{
+		Restore: func(sess *Session, userID string) {
+			sess.Set("user", userID)
+			restored = append(restored, userID)
+		},
+		OnTheft: func(userID string) {
+			stolen = append(stolen, userID)
+		},
+	})
+
+	cookieOf := func(rec *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, cookie := range rec.Result().Cookies() {
+			if cookie.Name == name {
+				return cookie
+			}
+		}
+
+		return nil
+	}
+
+	request := func(cookies ...*http.Cookie) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, cookie := range cookies {
+			r.AddCookie(cookie)
+		}
+
+		return r
+	}
+
+	// login.
+	rec := httptest.NewRecorder()
+	r := request()
+	sess := sessions.Start(rec, r)
+	sess.Set("user", "kataras")
+	if err := sessions.Remember(rec, r, "kataras"); err != nil {
+		t.Fatal(err)
+	}
+
+	first := cookieOf(rec, DefaultRememberCookieName)
+	if first == nil || first.MaxAge <= 0 {
+		t.Fatalf("expected a long-lived remember-me cookie")
+	}
+
+	// the session is alive, the token is not used.
+	rec = httptest.NewRecorder()
+	sessions.Start(rec, request(&http.Cookie{Name: DefaultCookieName, Value: sess.ID()}, first))
+	if cookieOf(rec, DefaultRememberCookieName) != nil || len(restored) != 0 {
+		t.Fatalf("expected the token to not be used while the session is alive")
+	}
+
+	// the session has expired.
+	sessions.DestroyByID(sess.ID())
+	rec = httptest.NewRecorder()
+	sess = sessions.Start(rec, request(&http.Cookie{Name: DefaultCookieName, Value: sess.ID()}, first))
+	second := cookieOf(rec, DefaultRememberCookieName)
+	if sess.GetString("user") != "kataras" || len(restored) != 1 {
+		t.Fatalf("expected the session to be restored but got %v", restored)
+	}
+
+	if second == nil || second.Value == first.Value {
+		t.Fatalf("expected the token to be rotated")
+	}
+
+	// again, with the rotated token.
+	sessions.DestroyByID(sess.ID())
+	rec = httptest.NewRecorder()
+	sess = sessions.Start(rec, request(second))
+	third := cookieOf(rec, DefaultRememberCookieName)
+	if sess.GetString("user") != "kataras" || third == nil || third.Value == second.Value {
+		t.Fatalf("expected the session to be restored by the rotated token")
+	}
+
+	// the first token is used after its rotations, it's stolen.
+	rec = httptest.NewRecorder()
+	if sess = sessions.Start(rec, request(first)); sess.Get("user") != nil {
+		t.Fatalf("expected a stolen token to be rejected")
+	}
+
+	if len(stolen) != 1 || stolen[0] != "kataras" {
+		t.Fatalf("expected the theft to be reported but got %v", stolen)
+	}
+
+	// the series is revoked.
+	if sess = sessions.Start(httptest.NewRecorder(), request(third)); sess.Get("user") != nil {
+		t.Fatalf("expected the series to be revoked after a theft")
+	}
+
+	// logout.
+	rec = httptest.NewRecorder()
+	r = request()
+	sess = sessions.Start(rec, r)
+	if err := sessions.Remember(rec, r, "kataras"); err != nil {
+		t.Fatal(err)
+	}
+	token := cookieOf(rec, DefaultRememberCookieName)
+	r.AddCookie(token)
+	sessions.Forget(httptest.NewRecorder(), r)
+
+	if _, err := sess.GetE(context.Background(), rememberKey); err != ErrNotFound {
+		t.Fatalf("expected the session to be unbound from the series but got %v", err)
+	}
+
+	sessions.DestroyByID(sess.ID())
+	if sess = sessions.Start(httptest.NewRecorder(), request(token)); sess.Get("user") != nil {
+		t.Fatalf("expected the series to be revoked after a logout")
+	}
+}
+
+type recordingMetrics struct {
+	mu                    sync.Mutex
+	created, loaded, read int
+	destroyed             []DestroyReason
+	calls                 map[string]int
+}
+
+func (m *recordingMetrics) SessionCreated() { m.mu.Lock(); m.created++; m.mu.Unlock() }
+func (m *recordingMetrics) SessionLoaded()  { m.mu.Lock(); m.loaded++; m.mu.Unlock() }
+func (m *recordingMetrics) SessionRead()    { m.mu.Lock(); m.read++; m.mu.Unlock() }
+func (m *recordingMetrics) SessionDestroyed(reason DestroyReason) {
+	m.mu.Lock()
+	m.destroyed = append(m.destroyed, reason)
+	m.mu.Unlock()
+}
+func (m *recordingMetrics) DatabaseCall(method string, elapsed time.Duration, err error) {
+	m.mu.Lock()
+	m.calls[method]++
+	m.mu.Unlock()
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := &recordingMetrics{calls: make(map[string]int)}
+
+	sessions := New(Config{})
+	sessions.UseMetrics(metrics)
+
+	if _, ok := optional[Exister](sessions.provider.db); !ok {
+		t.Fatalf("expected the optional interfaces of the registered database to be kept")
+	}
+
+	sessions.UseDatabase(&legacyDatabase{values: make(map[string]map[string]interface{})})
+	if _, ok := optional[Exister](sessions.provider.db); ok {
+		t.Fatalf("expected the optional interfaces to be checked against the registered database")
+	}
+
+	rec := httptest.NewRecorder()
+	sess := sessions.Start(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	sess.Set("name", "go-sessions")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(rec.Result().Cookies()[0])
+	if sess = sessions.Start(httptest.NewRecorder(), r); sess.GetString("name") != "go-sessions" {
+		t.Fatalf("expected the session to be read")
+	}
+
+	sessions.DestroyByID(sess.ID())
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	if metrics.created != 1 || metrics.read != 1 || metrics.loaded != 0 {
+		t.Fatalf("expected 1 created and 1 read session but got %d created, %d read and %d loaded",
+			metrics.created, metrics.read, metrics.loaded)
+	}
+
+	if len(metrics.destroyed) != 1 || metrics.destroyed[0] != ReasonDestroyByID {
+		t.Fatalf("expected a destroyed session by id but got %v", metrics.destroyed)
+	}
+
+	if metrics.calls["SetContext"] == 0 || metrics.calls["GetContext"] == 0 || metrics.calls["ReleaseContext"] != 1 {
+		t.Fatalf("expected the database calls to be measured but got %v", metrics.calls)
+	}
+
+	if NewExpvarMetrics("test_sessions") != NewExpvarMetrics("test_sessions") {
+		t.Fatalf("expected the same expvar metrics for the same name")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("expected UseMetrics to panic after the first Start")
+		}
+	}()
+	sessions.UseMetrics(metrics)
+}
@@ -0,0 +1,294 @@
+package sessions
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+// Transport sends and receives the session id to and from the client,
+// i.e. through a cookie, a header or a url query parameter.
+// Select one through the `Config.Transport` field.
+//
+// The session ids a transport handles are already encoded by the `Config.Encode`, if any.
+type Transport interface {
+	// Get returns the client's session id or an empty string.
+	Get(r *http.Request) string
+	// Set sends the session id to the client, the "expires" follows the `Config.Expires` rules.
+	// The session id may be visible to the rest handlers of the same request as well,
+	// the `CookieTransport` does it only if the `Config.AllowReclaim` is true.
+	Set(w http.ResponseWriter, r *http.Request, sid string, expires time.Duration)
+	// Remove removes the session id from the client.
+	Remove(w http.ResponseWriter, r *http.Request)
+
+	// GetFasthttp returns the client's session id or an empty string.
+	GetFasthttp(ctx *fasthttp.RequestCtx) string
+	// SetFasthttp sends the session id to the client, the "expires" follows the `Config.Expires` rules.
+	// The session id may be visible to the rest handlers of the same request as well,
+	// the `CookieTransport` does it only if the `Config.AllowReclaim` is true.
+	SetFasthttp(ctx *fasthttp.RequestCtx, sid string, expires time.Duration)
+	// RemoveFasthttp removes the session id from the client.
+	RemoveFasthttp(ctx *fasthttp.RequestCtx)
+}
+
+// CookieTransport is the default `Transport`,
+// the session id travels through the `Config.Cookie`.
+type CookieTransport struct {
+	config Config
+}
+
+var _ Transport = (*CookieTransport)(nil)
+
+// NewCookieTransport returns a new cookie transport based on the cookie fields of the "config".
+func NewCookieTransport(config Config) *CookieTransport {
+	if config.Cookie == "" {
+		config.Cookie = DefaultCookieName
+	}
+
+	return &CookieTransport{config: config}
+}
+
+// Get returns the client's session id or an empty string.
+func (t *CookieTransport) Get(r *http.Request) string {
+	return GetCookie(r, t.config.Cookie)
+}
+
+// Set sends the session id cookie to the client,
+// it's added to the request's cookies too if the `Config.AllowReclaim` is true.
+func (t *CookieTransport) Set(w http.ResponseWriter, r *http.Request, sid string, expires time.Duration) {
+	cookie := newCookie(t.config, r.URL.Host, r.TLS != nil, sid)
+	setCookieExpiration(cookie, expires)
+
+	writeCookie(w, cookie, t.config.CookiePartitioned)
+	if t.config.AllowReclaim {
+		// the next `Start` calls of the same request should see that cookie.
+		SetRequestCookie(r, cookie.Name, cookie.Value)
+	}
+}
+
+// Remove deletes the session id cookie.
+func (t *CookieTransport) Remove(w http.ResponseWriter, r *http.Request) {
+	RemoveCookie(w, r, t.config)
+}
+
+// GetFasthttp returns the client's session id or an empty string.
+func (t *CookieTransport) GetFasthttp(ctx *fasthttp.RequestCtx) string {
+	return GetCookieFasthttp(ctx, t.config.Cookie)
+}
+
+// SetFasthttp sends the session id cookie to the client,
+// it's added to the request's cookies too if the `Config.AllowReclaim` is true.
+func (t *CookieTransport) SetFasthttp(ctx *fasthttp.RequestCtx, sid string, expires time.Duration) {
+	cookie := newCookie(t.config, string(ctx.Host()), ctx.IsTLS(), sid)
+	setCookieExpiration(cookie, expires)
+
+	writeCookieFasthttp(ctx, cookie, t.config.CookiePartitioned)
+	if t.config.AllowReclaim {
+		// the next `StartFasthttp` calls of the same request should see that cookie.
+		ctx.Request.Header.SetCookie(cookie.Name, sid)
+	}
+}
+
+// RemoveFasthttp deletes the session id cookie.
+func (t *CookieTransport) RemoveFasthttp(ctx *fasthttp.RequestCtx) {
+	RemoveCookieFasthttp(ctx, t.config)
+}
+
+func setCookieExpiration(cookie *http.Cookie, expires time.Duration) {
+	// MaxAge=0 means no 'Max-Age' attribute specified.
+	// MaxAge<0 means delete cookie now, equivalently 'Max-Age: 0'
+	// MaxAge>0 means Max-Age attribute present and given in seconds
+	if expires >= 0 {
+		if expires == 0 { // unlimited life
+			cookie.Expires = CookieExpireUnlimited
+		} else { // > 0
+			cookie.Expires = time.Now().Add(expires)
+		}
+		cookie.MaxAge = int(time.Until(cookie.Expires).Seconds())
+	}
+}
+
+// DefaultHeader is the default header name which
+// the `HeaderTransport` and the `QueryTransport` send the session id to the client.
+const DefaultHeader = "X-Session-ID"
+
+// HeaderTransport is a `Transport` which the session id travels through an http header,
+// e.g. "X-Session-ID: $sid" or "Authorization: Bearer $sid".
+// Useful for mobile clients and service-to-service communication.
+type HeaderTransport struct {
+	// Header is the request header which holds the session id.
+	Header string
+	// Scheme is the authorization scheme which prefixes the session id, e.g. "Bearer".
+	// Defaults to empty, the whole header's value is the session id.
+	Scheme string
+	// ResponseHeader is the response header which the session id is sent to the client,
+	// an empty value is sent on removal.
+	//
+	// Defaults to the Header field.
+	ResponseHeader string
+}
+
+var _ Transport = (*HeaderTransport)(nil)
+
+// NewHeaderTransport returns a new `HeaderTransport` which
+// the session id travels through the "header" for both request and response.
+func NewHeaderTransport(header string) *HeaderTransport {
+	if header == "" {
+		header = DefaultHeader
+	}
+
+	return &HeaderTransport{Header: header}
+}
+
+// NewBearerTransport returns a new `HeaderTransport` which
+// the session id is received through the "Authorization: Bearer $sid" request header
+// and it's sent to the client through the `DefaultHeader` response header.
+func NewBearerTransport() *HeaderTransport {
+	return &HeaderTransport{
+		Header:         "Authorization",
+		Scheme:         "Bearer",
+		ResponseHeader: DefaultHeader,
+	}
+}
+
+func (t *HeaderTransport) parse(value string) string {
+	if t.Scheme == "" {
+		return value
+	}
+
+	if len(value) <= len(t.Scheme) || !strings.EqualFold(value[0:len(t.Scheme)], t.Scheme) || value[len(t.Scheme)] != ' ' {
+		return ""
+	}
+
+	return strings.TrimSpace(value[len(t.Scheme)+1:])
+}
+
+func (t *HeaderTransport) format(sid string) string {
+	if t.Scheme == "" {
+		return sid
+	}
+
+	return t.Scheme + " " + sid
+}
+
+func (t *HeaderTransport) responseHeader() string {
+	if t.ResponseHeader == "" {
+		return t.Header
+	}
+
+	return t.ResponseHeader
+}
+
+// Get returns the client's session id or an empty string.
+func (t *HeaderTransport) Get(r *http.Request) string {
+	return t.parse(r.Header.Get(t.Header))
+}
+
+// Set sends the session id to the client through the response header.
+func (t *HeaderTransport) Set(w http.ResponseWriter, r *http.Request, sid string, expires time.Duration) {
+	w.Header().Set(t.responseHeader(), sid)
+	r.Header.Set(t.Header, t.format(sid))
+}
+
+// Remove sends an empty response header.
+func (t *HeaderTransport) Remove(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(t.responseHeader(), "")
+	r.Header.Del(t.Header)
+}
+
+// GetFasthttp returns the client's session id or an empty string.
+func (t *HeaderTransport) GetFasthttp(ctx *fasthttp.RequestCtx) string {
+	return t.parse(string(ctx.Request.Header.Peek(t.Header)))
+}
+
+// SetFasthttp sends the session id to the client through the response header.
+func (t *HeaderTransport) SetFasthttp(ctx *fasthttp.RequestCtx, sid string, expires time.Duration) {
+	ctx.Response.Header.Set(t.responseHeader(), sid)
+	ctx.Request.Header.Set(t.Header, t.format(sid))
+}
+
+// RemoveFasthttp sends an empty response header.
+func (t *HeaderTransport) RemoveFasthttp(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set(t.responseHeader(), "")
+	ctx.Request.Header.Del(t.Header)
+}
+
+// DefaultQueryParam is the default url query parameter which
+// the `QueryTransport` receives the session id.
+const DefaultQueryParam = "sid"
+
+// QueryTransport is a `Transport` which the session id is received through a url query parameter,
+// e.g. "?sid=$sid". A url query is a request-only thing,
+// so the session id is sent to the client through a response header instead.
+type QueryTransport struct {
+	// Param is the url query parameter which holds the session id.
+	Param string
+	// ResponseHeader is the response header which the session id is sent to the client,
+	// an empty value is sent on removal.
+	//
+	// Defaults to the `DefaultHeader`.
+	ResponseHeader string
+}
+
+var _ Transport = (*QueryTransport)(nil)
+
+// NewQueryTransport returns a new `QueryTransport` which
+// the session id is received through the "param" url query parameter,
+// it defaults to the `DefaultQueryParam`.
+func NewQueryTransport(param string) *QueryTransport {
+	if param == "" {
+		param = DefaultQueryParam
+	}
+
+	return &QueryTransport{Param: param}
+}
+
+func (t *QueryTransport) responseHeader() string {
+	if t.ResponseHeader == "" {
+		return DefaultHeader
+	}
+
+	return t.ResponseHeader
+}
+
+// Get returns the client's session id or an empty string.
+func (t *QueryTransport) Get(r *http.Request) string {
+	return r.URL.Query().Get(t.Param)
+}
+
+// Set sends the session id to the client through the response header.
+func (t *QueryTransport) Set(w http.ResponseWriter, r *http.Request, sid string, expires time.Duration) {
+	w.Header().Set(t.responseHeader(), sid)
+
+	query := r.URL.Query()
+	query.Set(t.Param, sid)
+	r.URL.RawQuery = query.Encode()
+}
+
+// Remove sends an empty response header.
+func (t *QueryTransport) Remove(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set(t.responseHeader(), "")
+
+	query := r.URL.Query()
+	query.Del(t.Param)
+	r.URL.RawQuery = query.Encode()
+}
+
+// GetFasthttp returns the client's session id or an empty string.
+func (t *QueryTransport) GetFasthttp(ctx *fasthttp.RequestCtx) string {
+	return string(ctx.QueryArgs().Peek(t.Param))
+}
+
+// SetFasthttp sends the session id to the client through the response header.
+func (t *QueryTransport) SetFasthttp(ctx *fasthttp.RequestCtx, sid string, expires time.Duration) {
+	ctx.Response.Header.Set(t.responseHeader(), sid)
+	ctx.QueryArgs().Set(t.Param, sid)
+}
+
+// RemoveFasthttp sends an empty response header.
+func (t *QueryTransport) RemoveFasthttp(ctx *fasthttp.RequestCtx) {
+	ctx.Response.Header.Set(t.responseHeader(), "")
+	ctx.QueryArgs().Del(t.Param)
+}
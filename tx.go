@@ -0,0 +1,245 @@
+package sessions
+
+import (
+	"context"
+	"hash/fnv"
+)
+
+// Tx is a transaction over the values of a single session, see `Session.Update`.
+// It's implemented by the databases which implement the `Transactional` interface.
+type Tx interface {
+	// Get returns the value of the "key",
+	// it returns an `ErrNotFound` if the key does not exist.
+	Get(key string) (interface{}, error)
+	// Set stores the "value" of the "key".
+	Set(key string, value interface{}) error
+	// Delete removes the "key", it reports whether the key existed.
+	Delete(key string) (bool, error)
+}
+
+// Transactional is an optional interface that a `DatabaseContext` can implement
+// in order to run the `Session.Update` in a single database transaction.
+//
+// The "fn" may be called more than once, i.e. on a conflict with a concurrent transaction,
+// its writes should be discarded when it returns an error.
+//
+// A database which does not implement it runs the `Session.Update` under a per-session lock instead,
+// which protects the values only from the concurrent updates of the same process.
+type Transactional interface {
+	UpdateContext(ctx context.Context, sid string, lifetime LifeTime, fn func(tx Tx) error) error
+}
+
+// SessionTx is the read-write view of a session's values inside a `Session.Update`.
+type SessionTx struct {
+	sess   *Session
+	tx     Tx
+	writes []txWrite
+}
+
+// ID returns the session's id.
+func (tx *SessionTx) ID() string {
+	return tx.sess.ID()
+}
+
+// Get returns the value of the "key", or nil if it does not exist.
+func (tx *SessionTx) Get(key string) interface{} {
+	v, _ := tx.GetE(key)
+	return v
+}
+
+// GetE same as `Get` but it returns any error coming from the registered database,
+// including the `ErrNotFound` if the "key" does not exist.
+func (tx *SessionTx) GetE(key string) (interface{}, error) {
+	return tx.tx.Get(key)
+}
+
+// Set stores the "value" of the "key", the change is visible to the rest of the session
+// only after the transaction is committed.
+func (tx *SessionTx) Set(key string, value interface{}) error {
+	if err := tx.tx.Set(key, value); err != nil {
+		return err
+	}
+
+	tx.writes = append(tx.writes, txWrite{key: key, value: value})
+	return nil
+}
+
+// Delete removes the "key", it reports whether the key existed.
+func (tx *SessionTx) Delete(key string) (bool, error) {
+	removed, err := tx.tx.Delete(key)
+	if err != nil {
+		return false, err
+	}
+
+	if removed {
+		tx.writes = append(tx.writes, txWrite{key: key, deleted: true})
+	}
+
+	return removed, nil
+}
+
+// Increment increments the int value of the "key" by "n",
+// if the "key" does not exist then it creates one with the "n" as its value.
+// It returns the new, incremented, value.
+func (tx *SessionTx) Increment(key string, n int) (int, error) {
+	v, err := tx.GetE(key)
+	if err != nil && err != ErrNotFound {
+		return 0, err
+	}
+
+	var current int
+	if v != nil {
+		current, _ = convertValue[int](v)
+	}
+
+	newValue := current + n
+	return newValue, tx.Set(key, newValue)
+}
+
+// Update runs "fn" in a single transaction of the registered database,
+// see the `Transactional` interface, so concurrent requests of the same session
+// do not lose updates and several keys can be changed as one unit.
+// The changes are discarded if "fn" returns an error, which is returned back to the caller.
+//
+// The "fn" may be called more than once, i.e. on a conflict with a concurrent transaction,
+// so it should not have any side effects other than its changes through the "tx".
+// Do not call other methods of the session inside the "fn".
+//
+// On `Config.WriteBehind` the "fn" runs on the buffered values of the session,
+// under a per-session lock, and its changes are written to the database with the rest of them.
+func (s *Session) Update(fn func(tx *SessionTx) error) error {
+	return s.UpdateContext(context.Background(), fn)
+}
+
+// UpdateContext same as `Update` but it accepts a context,
+// which is passed to the registered database.
+func (s *Session) UpdateContext(ctx context.Context, fn func(tx *SessionTx) error) error {
+	s.persist(ctx)
+
+	var stx *SessionTx
+	run := func(tx Tx) error {
+		stx = &SessionTx{sess: s, tx: tx} // a new one on each retry.
+		return fn(stx)
+	}
+
+	var err error
+	db := s.database()
+	if tdb, ok := optional[Transactional](db); ok {
+		err = tdb.UpdateContext(ctx, s.ID(), s.lifetime(), run)
+	} else {
+		err = s.provider.update(ctx, db, s, run)
+	}
+
+	if err != nil || stx == nil || len(stx.writes) == 0 {
+		return err
+	}
+
+	s.mu.Lock()
+	s.isNew = false
+	s.mu.Unlock()
+
+	for _, w := range stx.writes {
+		if w.deleted {
+			s.provider.hooks.fireDelete(s, w.key)
+		} else {
+			s.provider.hooks.fireSet(s, w.key, w.value)
+		}
+	}
+
+	return nil
+}
+
+// txLocksLen is the number of the locks that protect the sessions' updates
+// of a database which does not implement the `Transactional` interface.
+const txLocksLen = 64
+
+// update runs the "fn" under the lock of the "sess",
+// for a database which does not implement the `Transactional` interface, i.e. the memory one.
+// The lock is striped by the session id, so the updates of different sessions do not wait each other,
+// and the database is locked only on its reads and writes, so the "fn" can read the session.
+// An immutable entry is kept immutable, see `Session.SetImmutable`.
+func (p *provider) update(ctx context.Context, db DatabaseContext, sess *Session, fn func(tx Tx) error) error {
+	h := fnv.New32a()
+	h.Write([]byte(sess.ID()))
+	mu := &p.txLocks[h.Sum32()%txLocksLen]
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	tx := &txBuffer{get: func(key string) (interface{}, error) {
+		return db.GetContext(ctx, sess.ID(), key)
+	}}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.commit(func(key string, value interface{}) error {
+		return db.SetContext(ctx, sess.ID(), sess.lifetime(), key, value, isImmutable(db, sess.ID(), key))
+	}, func(key string) error {
+		_, err := db.DeleteContext(ctx, sess.ID(), key)
+		return err
+	})
+}
+
+// txWrite is a write of a transaction, a set or a removal of a key.
+type txWrite struct {
+	key     string
+	value   interface{}
+	deleted bool
+}
+
+// txBuffer is a `Tx` which keeps its writes until its commit,
+// its reads see its own writes first.
+type txBuffer struct {
+	get    func(key string) (interface{}, error)
+	writes []txWrite
+}
+
+var _ Tx = (*txBuffer)(nil)
+
+func (tx *txBuffer) Get(key string) (interface{}, error) {
+	for i := len(tx.writes) - 1; i >= 0; i-- {
+		if w := tx.writes[i]; w.key == key {
+			if w.deleted {
+				return nil, ErrNotFound
+			}
+
+			return w.value, nil
+		}
+	}
+
+	return tx.get(key)
+}
+
+func (tx *txBuffer) Set(key string, value interface{}) error {
+	tx.writes = append(tx.writes, txWrite{key: key, value: value})
+	return nil
+}
+
+func (tx *txBuffer) Delete(key string) (bool, error) {
+	_, err := tx.Get(key)
+	if err != nil && err != ErrNotFound {
+		return false, err
+	}
+
+	tx.writes = append(tx.writes, txWrite{key: key, deleted: true})
+	return err == nil, nil
+}
+
+func (tx *txBuffer) commit(set func(key string, value interface{}) error, del func(key string) error) error {
+	for _, w := range tx.writes {
+		var err error
+		if w.deleted {
+			err = del(w.key)
+		} else {
+			err = set(w.key, w.value)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,256 @@
+package sessions
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// Get returns the session's value of the "key" as T.
+// The value is converted across the representations that the databases return,
+// i.e. an int stored through a JSON transcoder is read back as float64
+// and a struct as a map[string]interface{}, the Get converts them back to T.
+//
+// It returns the `ErrNotFound` if the "key" does not exist
+// and a non-nil error if the value can not be converted to T.
+func Get[T any](sess *Session, key string) (T, error) {
+	return GetContext[T](context.Background(), sess, key)
+}
+
+// GetContext same as `Get` but it accepts a context,
+// which is passed to the registered database.
+func GetContext[T any](ctx context.Context, sess *Session, key string) (T, error) {
+	var zero T
+
+	value, err := sess.GetE(ctx, key)
+	if err != nil {
+		return zero, err
+	}
+
+	if value == nil {
+		return zero, ErrNotFound
+	}
+
+	v, ok := convertValue[T](value)
+	if !ok {
+		return zero, fmt.Errorf(errFindParse, reflect.TypeOf(&zero).Elem(), key)
+	}
+
+	return v, nil
+}
+
+// GetOr same as `Get` but it returns the "defaultValue"
+// if the "key" does not exist or its value can not be converted to T.
+func GetOr[T any](sess *Session, key string, defaultValue T) T {
+	if v, err := Get[T](sess, key); err == nil {
+		return v
+	}
+
+	return defaultValue
+}
+
+// Key is a typed session key, see `NewKey`.
+type Key[T any] struct {
+	name string
+}
+
+// NewKey returns a typed session key, so the value's type is declared once.
+//
+// Example:
+//
+//	var UserID = sessions.NewKey[int64]("user_id")
+//
+//	UserID.Set(sess, 42)
+//	id, err := UserID.Get(sess)
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{name: name}
+}
+
+// Name returns the key's name, the actual key of the session's value.
+func (k Key[T]) Name() string {
+	return k.name
+}
+
+// Get returns the session's value of this key, see the package-level `Get`.
+func (k Key[T]) Get(sess *Session) (T, error) {
+	return Get[T](sess, k.name)
+}
+
+// GetOr returns the session's value of this key or the "defaultValue", see `GetOr`.
+func (k Key[T]) GetOr(sess *Session, defaultValue T) T {
+	return GetOr(sess, k.name, defaultValue)
+}
+
+// Set fills the session with the "value" of this key.
+func (k Key[T]) Set(sess *Session, value T) {
+	sess.Set(k.name, value)
+}
+
+// SetE same as `Set` but it returns any error coming from the registered database.
+func (k Key[T]) SetE(ctx context.Context, sess *Session, value T) error {
+	return sess.SetE(ctx, k.name, value)
+}
+
+// Delete removes the session's value of this key,
+// returns true if actually something was removed.
+func (k Key[T]) Delete(sess *Session) bool {
+	return sess.Delete(k.name)
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// convertValue converts the "value" to T, it reports whether the conversion was successful.
+func convertValue[T any](value interface{}) (T, bool) {
+	if v, ok := value.(T); ok {
+		return v, true
+	}
+
+	var zero T
+	out := reflect.New(reflect.TypeOf(&zero).Elem()).Elem()
+	if !convertInto(out, value) {
+		return zero, false
+	}
+
+	return out.Interface().(T), true
+}
+
+func convertInto(out reflect.Value, value interface{}) bool {
+	in := reflect.ValueOf(value)
+	if in.Type().ConvertibleTo(out.Type()) && in.Kind() == out.Kind() {
+		out.Set(in.Convert(out.Type()))
+		return true
+	}
+
+	switch out.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if out.Type() == durationType && in.Kind() == reflect.String {
+			d, err := time.ParseDuration(in.String())
+			if err != nil {
+				return false
+			}
+
+			out.SetInt(int64(d))
+			return true
+		}
+
+		n, ok := toInt64(in)
+		if !ok || out.OverflowInt(n) {
+			return false
+		}
+		out.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, ok := toUint64(in)
+		if !ok || out.OverflowUint(n) {
+			return false
+		}
+		out.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, ok := toFloat64(in)
+		if !ok || out.OverflowFloat(f) {
+			return false
+		}
+		out.SetFloat(f)
+	case reflect.Bool:
+		if in.Kind() != reflect.String {
+			return false
+		}
+
+		b, err := strconv.ParseBool(in.String())
+		if err != nil {
+			return false
+		}
+		out.SetBool(b)
+	case reflect.String:
+		switch in.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			out.SetString(strconv.FormatInt(in.Int(), 10))
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			out.SetString(strconv.FormatUint(in.Uint(), 10))
+		case reflect.Float32, reflect.Float64:
+			out.SetString(strconv.FormatFloat(in.Float(), 'f', -1, 64))
+		case reflect.Bool:
+			out.SetString(strconv.FormatBool(in.Bool()))
+		case reflect.Slice:
+			if b, ok := value.([]byte); ok {
+				out.SetString(string(b))
+				return true
+			}
+			return false
+		default:
+			return false
+		}
+	default:
+		// i.e. a struct, a slice, a map or a time.Time,
+		// decoded as map[string]interface{}, []interface{} or string by a JSON transcoder.
+		b, err := DefaultTranscoder.Marshal(value)
+		if err != nil {
+			return false
+		}
+
+		return DefaultTranscoder.Unmarshal(b, out.Addr().Interface()) == nil
+	}
+
+	return true
+}
+
+func toInt64(in reflect.Value) (int64, bool) {
+	switch in.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return in.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n := in.Uint(); n <= math.MaxInt64 {
+			return int64(n), true
+		}
+	case reflect.Float32, reflect.Float64:
+		if f := in.Float(); f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64 {
+			return int64(f), true
+		}
+	case reflect.String:
+		if n, err := strconv.ParseInt(in.String(), 10, 64); err == nil {
+			return n, true
+		}
+	}
+
+	return 0, false
+}
+
+func toUint64(in reflect.Value) (uint64, bool) {
+	switch in.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n := in.Int(); n >= 0 {
+			return uint64(n), true
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return in.Uint(), true
+	case reflect.Float32, reflect.Float64:
+		if f := in.Float(); f == math.Trunc(f) && f >= 0 && f < math.MaxUint64 {
+			return uint64(f), true
+		}
+	case reflect.String:
+		if n, err := strconv.ParseUint(in.String(), 10, 64); err == nil {
+			return n, true
+		}
+	}
+
+	return 0, false
+}
+
+func toFloat64(in reflect.Value) (float64, bool) {
+	switch in.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(in.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(in.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return in.Float(), true
+	case reflect.String:
+		if f, err := strconv.ParseFloat(in.String(), 64); err == nil {
+			return f, true
+		}
+	}
+
+	return 0, false
+}
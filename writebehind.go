@@ -0,0 +1,250 @@
+package sessions
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// writeBuffer is the `DatabaseContext` of a session on `Config.WriteBehind`,
+// it loads the session's values from the registered database once,
+// it serves the reads from memory and it keeps the changed keys until the `flush`.
+type writeBuffer struct {
+	sess    *Session
+	mu      sync.Mutex
+	loaded  bool
+	values  Store
+	dirty   map[string]struct{}
+	cleared bool
+}
+
+var _ DatabaseContext = (*writeBuffer)(nil)
+
+func newWriteBuffer(sess *Session) *writeBuffer {
+	return &writeBuffer{sess: sess}
+}
+
+// underlying returns the registered database.
+func (b *writeBuffer) underlying() DatabaseContext {
+	return b.sess.provider.db
+}
+
+// load reads the session's values from the registered database, if not loaded already.
+// The caller should hold the lock.
+func (b *writeBuffer) load(ctx context.Context) error {
+	if b.loaded {
+		return nil
+	}
+
+	var values Store
+	err := b.underlying().VisitContext(ctx, b.sess.ID(), func(key string, value interface{}) {
+		values.Save(key, value, false)
+	})
+	if err != nil {
+		return err
+	}
+
+	b.values = values
+	b.loaded = true
+	return nil
+}
+
+// reset drops the loaded values, if there are no changes to write,
+// so the next request of the session reads them from the registered database again,
+// i.e. values changed by another instance of the application.
+func (b *writeBuffer) reset() {
+	b.mu.Lock()
+	if !b.cleared && len(b.dirty) == 0 {
+		b.values = nil
+		b.loaded = false
+	}
+	b.mu.Unlock()
+}
+
+func (b *writeBuffer) markDirty(key string) {
+	if b.dirty == nil {
+		b.dirty = make(map[string]struct{})
+	}
+
+	b.dirty[key] = struct{}{}
+}
+
+// flush writes the changes to the registered database, in a single transaction
+// if the database implements the `Transactional` interface.
+func (b *writeBuffer) flush(ctx context.Context) error {
+	lifetime := b.sess.lifetime() // before the buffer's lock, the session's lock is held on its clear.
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.cleared && len(b.dirty) == 0 {
+		return nil
+	}
+
+	db, sid := b.underlying(), b.sess.ID()
+	if b.cleared {
+		if err := db.ClearContext(ctx, sid); err != nil {
+			return err
+		}
+		b.cleared = false
+	}
+
+	write := func(set func(key string, value interface{}, immutable bool) error, del func(key string) error) error {
+		for key := range b.dirty {
+			var err error
+			if entry := b.values.GetEntry(key); entry != nil {
+				err = set(key, entry.ValueRaw, entry.immutable)
+			} else {
+				err = del(key)
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	var err error
+	if tdb, ok := optional[Transactional](db); ok {
+		err = tdb.UpdateContext(ctx, sid, lifetime, func(tx Tx) error {
+			return write(func(key string, value interface{}, _ bool) error {
+				return tx.Set(key, value)
+			}, func(key string) error {
+				_, err := tx.Delete(key)
+				return err
+			})
+		})
+	} else {
+		err = write(func(key string, value interface{}, immutable bool) error {
+			return db.SetContext(ctx, sid, lifetime, key, value, immutable)
+		}, func(key string) error {
+			_, err := db.DeleteContext(ctx, sid, key)
+			return err
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	b.dirty = nil
+	return nil
+}
+
+func (b *writeBuffer) AcquireContext(ctx context.Context, sid string, expires time.Duration) (LifeTime, error) {
+	return b.underlying().AcquireContext(ctx, sid, expires)
+}
+
+func (b *writeBuffer) OnUpdateExpirationContext(ctx context.Context, sid string, newExpires time.Duration) error {
+	return b.underlying().OnUpdateExpirationContext(ctx, sid, newExpires)
+}
+
+func (b *writeBuffer) SetContext(ctx context.Context, _ string, _ LifeTime, key string, value interface{}, immutable bool) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.load(ctx); err != nil {
+		return err
+	}
+
+	b.values.Save(key, value, immutable)
+	b.markDirty(key)
+	return nil
+}
+
+func (b *writeBuffer) GetContext(ctx context.Context, _ string, key string) (interface{}, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.load(ctx); err != nil {
+		return nil, err
+	}
+
+	v := b.values.Get(key)
+	if v == nil {
+		return nil, ErrNotFound
+	}
+
+	return v, nil
+}
+
+func (b *writeBuffer) VisitContext(ctx context.Context, _ string, cb func(key string, value interface{})) error {
+	b.mu.Lock()
+	if err := b.load(ctx); err != nil {
+		b.mu.Unlock()
+		return err
+	}
+	values := append(Store(nil), b.values...)
+	b.mu.Unlock()
+
+	values.Visit(cb)
+	return nil
+}
+
+func (b *writeBuffer) LenContext(ctx context.Context, _ string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.load(ctx); err != nil {
+		return 0, err
+	}
+
+	return b.values.Len(), nil
+}
+
+func (b *writeBuffer) DeleteContext(ctx context.Context, _ string, key string) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err := b.load(ctx); err != nil {
+		return false, err
+	}
+
+	removed := b.values.Remove(key)
+	if removed {
+		b.markDirty(key)
+	}
+
+	return removed, nil
+}
+
+func (b *writeBuffer) ClearContext(ctx context.Context, _ string) error {
+	b.mu.Lock()
+	b.values.Reset()
+	b.dirty = nil
+	b.cleared = true
+	b.loaded = true
+	b.mu.Unlock()
+	return nil
+}
+
+// ReleaseContext discards the changes and it releases the session from the registered database.
+func (b *writeBuffer) ReleaseContext(ctx context.Context, sid string) error {
+	b.mu.Lock()
+	b.values = nil
+	b.dirty = nil
+	b.cleared = false
+	b.loaded = false
+	b.mu.Unlock()
+
+	return b.underlying().ReleaseContext(ctx, sid)
+}
+
+// Commit writes the buffered changes of the session to the registered database,
+// see `Config.WriteBehind`. The `Handler` and `HandlerFasthttp` middlewares call it automatically.
+// It does nothing if the session is not buffered or there are no changes.
+func (s *Session) Commit() error {
+	return s.CommitContext(context.Background())
+}
+
+// CommitContext same as `Commit` but it accepts a context,
+// which is passed to the registered database.
+func (s *Session) CommitContext(ctx context.Context) error {
+	if s.buffer == nil {
+		return nil
+	}
+
+	return s.buffer.flush(ctx)
+}